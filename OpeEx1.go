@@ -3,9 +3,14 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"encoding/json"
 	"crypto/x509"
 )
@@ -14,58 +19,541 @@ import (
 type SimpleChaincode struct {
 }
 
+// What the chaincode uses of a stub: a *shim.ChaincodeStub wrapped in ShimStub
+// on a peer, a stub kept in memory in the tests
+type LedgerStub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	RangeQueryState(startKey string, endKey string) (StateIterator, error)
+	GetCallerCertificate() ([]byte, error)
+	GetTxID() string
+	GetTxTimestamp() (*timestamp.Timestamp, error)
+}
+
+// Iterator returned by RangeQueryState
+type StateIterator interface {
+	HasNext() bool
+	Next() (string, []byte, error)
+	Close() error
+}
+
+// LedgerStub of a peer
+type ShimStub struct {
+	*shim.ChaincodeStub
+}
+
+//
+// ShimStub: RangeQueryState
+//
+func (s ShimStub) RangeQueryState(startKey string, endKey string) (StateIterator, error) {
+	return s.ChaincodeStub.RangeQueryState(startKey, endKey)
+}
+
+// Currency in which Amount balances are kept
+const REPORTING_CURRENCY = "JPY"
+
+// Decimal places of Money and Ratio
+const (
+	MONEY_SCALE	= 4			// 1 Money = 0.0001 of a currency unit
+	RATIO_SCALE	= 8			// 1 Ratio = 0.00000001
+	MONEY_UNIT	= 10000			// Money of one currency unit
+	RATIO_UNIT	= 100000000		// Ratio of 1
+)
+
+// Rounding modes, kept under "config/money"
+const (
+	ROUND_HALF_UP	= "half_up"		// 0.00005 -> 0.0001, -0.00005 -> -0.0001
+	ROUND_HALF_EVEN	= "half_even"		// 0.00005 -> 0, 0.00015 -> 0.0002
+	ROUND_DOWN	= "down"		// towards zero
+)
+
+// Every rounding mode
+var ROUNDING_MODES = []string{ROUND_HALF_UP, ROUND_HALF_EVEN, ROUND_DOWN}
+
+// Decimal numbers accepted from arguments and written by Money and Ratio
+var DECIMAL_SYNTAX = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// Numbers of JSON, as written by records before Money existed
+var JSON_NUMBER_SYNTAX = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Mode in which numbers written before Money existed are rounded to MONEY_SCALE and RATIO_SCALE
+const LEGACY_ROUNDING = ROUND_HALF_UP
+
+// Amount in a currency, in units of 10^-MONEY_SCALE
+// Written to JSON as a decimal string with MONEY_SCALE places, "1234.5000"
+type Money int64
+
+// Exchange rate or percent, in units of 10^-RATIO_SCALE
+// Written to JSON as a decimal string with RATIO_SCALE places, "108.25000000"
+type Ratio int64
+
+// Record of money policy
+type MoneyConfig struct {
+	Rounding	string	`json:"rounding"`	// ROUND_*, used where an amount is converted at a rate
+}
+
+// Result of migrate_money
+type MoneyMigration struct {
+	Keys		uint64		`json:"keys"`		// records read
+	Rewritten	uint64		`json:"rewritten"`	// records whose JSON changed
+}
+
+// Roles granted to users
+const (
+	ROLE_ADMIN	= "admin"		// may grant roles, implies every other role
+	ROLE_RATE	= "rate_admin"		// may maintain the exchange-rate table
+	ROLE_BUDGET	= "budget_admin"	// may set the budgets of entities
+)
+
+// Year-labelling conventions of the fiscal calendar
+const (
+	FY_LABEL_START	= "start"		// year in which the fiscal year starts, FY2016 = Apr 2016 - Mar 2017
+	FY_LABEL_END	= "end"			// year in which the fiscal year ends, FY2017 = Apr 2016 - Mar 2017
+)
+
+// Record of fiscal calendar, kept under "config/fiscal_calendar"
+type FiscalCalendar struct {
+	StartMonth	uint8	`json:"start_month"`	// 4 for April
+	YearLabel	string	`json:"year_label"`	// FY_LABEL_START | FY_LABEL_END
+	Quarters	[]uint8	`json:"quarters"`	// first month of Q1..Q4
+	TimeZone	string	`json:"time_zone"`	// "JST"
+	UTCOffset	int	`json:"utc_offset"`	// seconds east of UTC, 32400 for JST
+}
+
+// Fiscal period containing a given date
+type FiscalPeriod struct {
+	Year		uint16	`json:"year"`
+	Quarter		uint8	`json:"quarter"`
+	YearStart	string	`json:"year_start"`	// RFC3339, inclusive
+	YearEnd		string	`json:"year_end"`	// RFC3339, exclusive
+}
+
+// Creation and update stamp embedded in every record
+type Stamp struct {
+	CreatedAt	string	`json:"created_at"`	// RFC3339, from transaction timestamp
+	UpdatedAt	string	`json:"updated_at"`	// RFC3339, from transaction timestamp
+	CreatedTx	string	`json:"created_tx"`	// transaction ID which created the record
+}
+
+// Roles of entity
+const (
+	ENTITY_ROLE_ISSUER	= "issuer"		// issues funds, holds the pool, only one may be active
+	ENTITY_ROLE_PARTICIPANT	= "participant"		// receives allocations through confirm
+)
+
+// Validation modes, kept under "config/validation"
+const (
+	VALIDATION_LENIENT	= "lenient"		// a percent which does not parse is taken as 0, an amount has to parse
+	VALIDATION_STRICT	= "strict"		// such a number, a negative amount or a percent outside 0-100 is an error
+)
+
+// Amount of a participant who is not participating, in either mode
+const NOT_PARTICIPATING = "-"
+
+// Record of validation mode
+type ValidationConfig struct {
+	Mode		string	`json:"mode"`		// VALIDATION_LENIENT | VALIDATION_STRICT
+}
+
+// Error in one field of the arguments
+type ValidationError struct {
+	Field		string	`json:"field"`		// "invest_amount" | "participants[0].amount" | ...
+	Value		string	`json:"value"`
+	Message		string	`json:"message"`
+}
+
+// Collects every ValidationError of a request before it is refused
+type Validator struct {
+	Mode		string			`json:"mode,omitempty"`
+	Errors		[]ValidationError	`json:"errors"`
+}
+
+// Consistency rules between the fields of a project
+const (
+	RULE_BENEFICIARY_PERCENT	= "beneficiary_percent"		// percents of the beneficiaries add up to 100
+	RULE_PARTICIPANT_AMOUNT		= "participant_amount"		// amounts of the participants add up to InvestAmount
+)
+
+// Every consistency rule, in the order they are checked
+var CONSISTENCY_RULES = []string{RULE_BENEFICIARY_PERCENT, RULE_PARTICIPANT_AMOUNT}
+
+// PercentTolerance until one is set, 0.005 percent
+const DEFAULT_PERCENT_TOLERANCE Ratio = RATIO_UNIT / 200
+
+// Record of consistency rules enforced by project / updateproject, kept under "config/consistency"
+type ConsistencyConfig struct {
+	Rules		[]string	`json:"rules"`		// RULE_*, none by default
+	Tolerance	Money		`json:"tolerance"`	// largest difference of amounts still taken as equal
+	PercentTolerance	Ratio	`json:"percent_tolerance"`	// largest difference of the percent total from 100 still taken as equal
+}
+
+// Consistency violations of an existing project
+type ProjectValidation struct {
+	ProjectId	string			`json:"project_id"`
+	Status		string			`json:"status"`
+	Errors		[]ValidationError	`json:"errors"`
+}
+
+// Status of project
+const (
+	PROJECT_STATUS_DRAFT			= "draft"			// registered, may still be updated
+	PROJECT_STATUS_SUBMITTED		= "submitted"			// open for confirmation
+	PROJECT_STATUS_PARTIALLY_CONFIRMED	= "partially_confirmed"		// confirmed by some participants
+	PROJECT_STATUS_CONFIRMED		= "confirmed"			// confirmed by every participant
+	PROJECT_STATUS_RENEGOTIATION		= "renegotiation"		// rejected or unconfirmed by a participant, to be submitted again
+	PROJECT_STATUS_CLOSED			= "closed"
+	PROJECT_STATUS_CANCELLED		= "cancelled"
+)
+
+// Statuses a project may move to from each status
+var PROJECT_TRANSITIONS = map[string][]string {
+	PROJECT_STATUS_DRAFT:			{ PROJECT_STATUS_SUBMITTED, PROJECT_STATUS_CANCELLED },
+	PROJECT_STATUS_SUBMITTED:		{ PROJECT_STATUS_PARTIALLY_CONFIRMED, PROJECT_STATUS_CONFIRMED, PROJECT_STATUS_RENEGOTIATION, PROJECT_STATUS_CANCELLED },
+	PROJECT_STATUS_PARTIALLY_CONFIRMED:	{ PROJECT_STATUS_PARTIALLY_CONFIRMED, PROJECT_STATUS_CONFIRMED, PROJECT_STATUS_RENEGOTIATION },
+	PROJECT_STATUS_CONFIRMED:		{ PROJECT_STATUS_CLOSED, PROJECT_STATUS_RENEGOTIATION },
+	PROJECT_STATUS_RENEGOTIATION:		{ PROJECT_STATUS_SUBMITTED, PROJECT_STATUS_PARTIALLY_CONFIRMED, PROJECT_STATUS_CONFIRMED, PROJECT_STATUS_RENEGOTIATION, PROJECT_STATUS_CANCELLED },
+	PROJECT_STATUS_CLOSED:			{ PROJECT_STATUS_CONFIRMED },
+	PROJECT_STATUS_CANCELLED:		{ PROJECT_STATUS_DRAFT },
+}
+
+// Fields patch_project may change in each status; amounts lock as well once any entity has confirmed
+var PROJECT_EDITABLE = map[string][]string {
+	PROJECT_STATUS_DRAFT:			{ "project_name", "invest_type", "invest_amount", "participant.dept", "participant.team", "participant.person", "participant.amount", "beneficiary.percent" },
+	PROJECT_STATUS_SUBMITTED:		{ "project_name", "invest_type", "invest_amount", "participant.dept", "participant.team", "participant.person", "participant.amount", "beneficiary.percent" },
+	PROJECT_STATUS_PARTIALLY_CONFIRMED:	{ "project_name", "invest_type", "participant.dept", "participant.team", "participant.person", "beneficiary.percent" },
+	PROJECT_STATUS_CONFIRMED:		{ "project_name", "invest_type", "participant.dept", "participant.team", "participant.person", "beneficiary.percent" },
+	PROJECT_STATUS_RENEGOTIATION:		{ "project_name", "invest_type", "invest_amount", "participant.dept", "participant.team", "participant.person", "participant.amount", "beneficiary.percent" },
+	PROJECT_STATUS_CLOSED:			{ "participant.dept", "participant.team", "participant.person" },
+	PROJECT_STATUS_CANCELLED:		{},
+}
+
+// Record of entity, kept under "entity/{code}"; its balance is the Amount under "{code}"
+type Entity struct {
+	Code		string	`json:"code"`		// "FG" | "BK" | "SC" | "TB" | ...
+	Name		string	`json:"name"`		// display name
+	Role		string	`json:"role"`		// ENTITY_ROLE_ISSUER | ENTITY_ROLE_PARTICIPANT
+	Active		bool	`json:"active"`
+	Members		[]string	`json:"members,omitempty"`	// users who may transfer from the entity
+	Stamp
+}
+
 // Record of current amount
 type Amount struct {
-	Entity		string	`json:"entity"`		// "FG" | BK" | "SC" | "TB"
-	Amount		float64	`json:"amount"`
+	Entity		string	`json:"entity"`		// code of a registered Entity
+	Amount		Money	`json:"amount"`
+	Reserved	Money	`json:"reserved,omitempty"`	// held for projects, Amount less Reserved is available
+	Currency	string	`json:"currency"`	// REPORTING_CURRENCY
+	Stamp
+}
+
+// Record of reservation policy, kept under "config/reservation"
+type ReservationConfig struct {
+	Enabled		bool	`json:"enabled"`	// project reserves the allocated amounts on the issuer
 }
 
-// Record of issue
+// Record of funds held on the issuer for a project until its entities confirm,
+// kept under "reservation/{project_id}"
+type Reservation struct {
+	ProjectId	string	`json:"project_id"`
+	Entity		string	`json:"entity"`		// issuer holding the funds
+	Amount		Money	`json:"amount"`		// amounts of the participants not yet confirmed
+	Stamp
+}
+
+// Accounts of the journal which are not entities
+const (
+	ACCOUNT_ISSUE	= "@ISSUE"	// funds issued into the ledger, credited by issue
+	ACCOUNT_OPENING	= "@OPENING"	// balances which existed before the journal, credited by open_journal
+)
+
+// Line of a journal entry, in REPORTING_CURRENCY
+type JournalLine struct {
+	Account		string	`json:"account"`	// entity code or ACCOUNT_*
+	Debit		Money	`json:"debit"`		// increases the balance of an entity
+	Credit		Money	`json:"credit"`		// decreases the balance of an entity
+}
+
+// Record of a balanced movement, kept under "journal/{sequence}" and indexed
+// per account under "journal_idx/{account}/{sequence}"
+type JournalEntry struct {
+	Sequence	uint64	`json:"sequence"`	// 1, 2, ..., counted under "journal_seq"
+	TxId		string	`json:"tx_id"`
+	Function	string	`json:"function"`	// Invoke function which made the movement
+	ProjectId	string	`json:"project_id,omitempty"`
+	Lines		[]JournalLine	`json:"lines"`	// debits and credits add up to the same amount
+	Stamp
+}
+
+// Balance of an entity checked against the journal
+type JournalCheck struct {
+	Entity		string	`json:"entity"`
+	Balance		Money	`json:"balance"`		// of Amount
+	JournalBalance	Money	`json:"journal_balance"`	// debits less credits of the journal
+	Difference	Money	`json:"difference"`
+}
+
+// Result of verify_journal
+type JournalReport struct {
+	Entries		uint64		`json:"entries"`
+	Unbalanced	[]uint64	`json:"unbalanced"`	// sequences whose debits and credits differ
+	Mismatches	[]JournalCheck	`json:"mismatches"`	// entities whose balance differs from the journal
+}
+
+// Movement of the balance of an entity, from its side of a journal entry
+type AmountMovement struct {
+	Sequence	uint64	`json:"sequence"`
+	TxId		string	`json:"tx_id"`
+	Timestamp	string	`json:"timestamp"`	// RFC3339, from transaction timestamp
+	Function	string	`json:"function"`
+	ProjectId	string	`json:"project_id,omitempty"`
+	Counterparty	string	`json:"counterparty"`	// other account of the entry
+	Debit		Money	`json:"debit"`
+	Credit		Money	`json:"credit"`
+	Balance		Money	`json:"balance"`	// running balance after the movement
+}
+
+// Result of get_amount_history
+type AmountHistory struct {
+	Entity		string	`json:"entity"`
+	Currency	string	`json:"currency"`	// REPORTING_CURRENCY
+	From		string	`json:"from,omitempty"`	// RFC3339, inclusive
+	To		string	`json:"to,omitempty"`	// RFC3339, exclusive
+	OpeningBalance	Money	`json:"opening_balance"`	// before the first movement of the range
+	ClosingBalance	Money	`json:"closing_balance"`	// after the last movement of the range
+	Movements	[]AmountMovement	`json:"movements"`
+}
+
+// Record of a closed fiscal year, kept under "period/{year}"; nothing may be
+// journaled into it once closed
+type FiscalClose struct {
+	Year		uint16		`json:"year"`
+	YearStart	string		`json:"year_start"`	// RFC3339, inclusive
+	YearEnd		string		`json:"year_end"`	// RFC3339, exclusive
+	ClosedBy	string		`json:"closed_by"`
+	Entities	[]string	`json:"entities"`	// with a snapshot under "snapshot/{year}/{entity}"
+	Stamp
+}
+
+// Balance of an entity over a fiscal year, kept under "snapshot/{year}/{entity}"
+// once the year is closed
+type BalanceSnapshot struct {
+	Entity		string	`json:"entity"`
+	Year		uint16	`json:"year"`
+	Currency	string	`json:"currency"`	// REPORTING_CURRENCY
+	Opening		Money	`json:"opening"`	// carried forward from the closing of the year before, once closed
+	Closing		Money	`json:"closing"`	// at the end of the year, the current balance while it lasts
+	Closed		bool	`json:"closed"`
+	Stamp
+}
+
+// Balance of an entity recomputed by audit_ledger
+type LedgerAuditLine struct {
+	Entity		string		`json:"entity"`
+	Balance		Money		`json:"balance"`		// of Amount
+	Issued		Money		`json:"issued"`		// net of reversals, as issuer
+	Allocated	Money		`json:"allocated"`	// confirmed allocations received
+	Paid		Money		`json:"paid"`		// confirmed allocations paid, as issuer
+	Received	Money		`json:"received"`	// by transfer
+	Sent		Money		`json:"sent"`		// by transfer
+	Expected	Money		`json:"expected"`	// Issued + Allocated - Paid + Received - Sent
+	Difference	Money		`json:"difference"`	// Balance - Expected
+	Reserved	Money		`json:"reserved"`	// of Amount
+	Held		Money		`json:"held"`		// by the reservations of projects
+	ProjectIds	[]string	`json:"project_ids"`	// projects which moved the balance
+}
+
+// Result of audit_ledger
+type LedgerAudit struct {
+	TotalIssued	Money			`json:"total_issued"`
+	TotalAllocated	Money			`json:"total_allocated"`
+	Entities	[]LedgerAuditLine	`json:"entities"`
+	Mismatches	[]LedgerAuditLine	`json:"mismatches"`	// Difference or Reserved - Held not 0
+}
+
+// Record of the budget of an entity for a fiscal year, kept under "budget/{year}/{entity}";
+// an entity without one for the year is not capped
+type Budget struct {
+	Entity		string	`json:"entity"`
+	Year		uint16	`json:"year"`		// Fiscal Year
+	Cap		Money	`json:"cap"`		// in REPORTING_CURRENCY
+	Used		Money	`json:"used"`		// net of reversals, kept up by post
+	SetBy		string	`json:"set_by"`
+	Stamp
+}
+
+// Result of get_budget_status; the issuer uses its budget by issue, any other
+// entity by taking allocations from the issuer, net of reversals
+type BudgetStatus struct {
+	Entity		string	`json:"entity"`
+	Year		uint16	`json:"year"`
+	Currency	string	`json:"currency"`	// REPORTING_CURRENCY
+	Capped		bool	`json:"capped"`		// false without a Budget, Cap and Remaining are then 0
+	Cap		Money	`json:"cap"`
+	Used		Money	`json:"used"`
+	Remaining	Money	`json:"remaining"`	// negative once over, by postings made before the cap
+}
+
+// Record of exchange rate
+type Rate struct {
+	Currency	string	`json:"currency"`	// "USD"
+	Rate		Ratio	`json:"rate"`		// 1 Currency = Rate REPORTING_CURRENCY
+	UpdatedBy	string	`json:"updated_by"`
+	Stamp
+}
+
+// Record of roles granted to a user
+type UserRole struct {
+	User		string		`json:"user"`
+	Roles		[]string	`json:"roles"`
+}
+
+// Kinds of issue tranche
+const (
+	ISSUE_KIND_ISSUE	= "issue"
+	ISSUE_KIND_REVERSAL	= "reversal"	// compensating entry, amounts are negative
+)
+
+// Record of issue, one per tranche under "issue/{project_id}/{tranche}"
+// Records written before tranches existed are kept under "issue/{project_id}" as tranche 1
 type Issue struct {
 	ProjectId	string	`json:"project_id"`	// {project_id} + "issue"
-	Currency	string	`json:"currency"`	// "JPY"
-	IssueRate	float64	`json:"issue_rate"`	// "1"
-	IssueAmount	float64	`json:"issue_amount"`
+	Tranche		uint32	`json:"tranche"`	// 1, 2, ...
+	Kind		string	`json:"kind"`		// ISSUE_KIND_ISSUE | ISSUE_KIND_REVERSAL
+	Reverses	uint32	`json:"reverses,omitempty"`	// tranche compensated by a reversal
+	ReversedAmount	Money	`json:"reversed_amount"`	// in Currency, reversed so far from an issue
+	Reason		string	`json:"reason,omitempty"`	// reason of a reversal
+	Currency	string	`json:"currency"`	// "JPY" | "USD" | "EUR"
+	IssueRate	Ratio	`json:"issue_rate"`	// rate to REPORTING_CURRENCY
+	IssueAmount	Money	`json:"issue_amount"`	// in Currency
+	ReportingAmount	Money	`json:"reporting_amount"`	// in REPORTING_CURRENCY
 	Issuer		string	`json:"issuer"`		// "FG"
 	IssueYear	uint16	`json:"issue_year"`	// Fiscal Year
+	Stamp
+}
+
+// Record of an entity participating in a project or distribution
+type Participant struct {
+	Entity		string	`json:"entity"`		// code of a registered participant Entity
+	Dept		string	`json:"dept"`
+	Team		string	`json:"team"`
+	Person		string	`json:"person"`
+	Amount		Money	`json:"amount"`
+	Confirmed	bool	`json:"confirmed"`	// Yes: true, No: false
+	ConfirmedBy	string	`json:"confirmed_by,omitempty"`
+	ConfirmedAt	string	`json:"confirmed_at,omitempty"`	// RFC3339, from transaction timestamp
+	ConfirmedTx	string	`json:"confirmed_tx,omitempty"`	// transaction ID which confirmed and moved the amount
+	Rejected	bool	`json:"rejected,omitempty"`
+	Reason		string	`json:"reason,omitempty"`	// of the last reject or unconfirm
+}
+
+// Positional arguments of a participant, before parsing
+type ParticipantArgs struct {
+	Entity		string
+	Dept		string
+	Team		string
+	Person		string
+	Amount		string
+}
+
+// Record of beneficiary group company, kept under "beneficiary/{code}"
+type Beneficiary struct {
+	Code		string	`json:"code"`		// "AMC" | "GCC" | "GMC" | "RBBC" | "CIC" | ...
+	Name		string	`json:"name"`		// display name
+	Active		bool	`json:"active"`		// false once retired
+	Stamp
+}
+
+// Share of a beneficiary in a project or receivable
+type BeneficiaryShare struct {
+	Code		string	`json:"code"`		// code of a registered Beneficiary
+	Percent		Ratio	`json:"percent"`
+	Amount		Money	`json:"amount,omitempty"`	// receivable only, in Currency
+}
+
+// Positional arguments of a beneficiary share, before parsing
+type BeneficiaryArgs struct {
+	Code		string
+	Percent		string
+	Amount		string
+}
+
+// Beneficiaries of the five fixed columns of positional arguments and of old records
+var LEGACY_BENEFICIARIES = []string{"AMC", "GCC", "GMC", "RBBC", "CIC"}
+
+// Positional arguments of project / updateproject, before parsing
+type ProjectArgs struct {
+	ProjectId	string
+	ProjectName	string
+	InvestType	string
+	InvestAmount	string
+	Beneficiaries	[]BeneficiaryArgs
+	KeepOthers	bool		// shares of other beneficiaries are kept by updateproject
+	Participants	[]ParticipantArgs
+}
+
+// Starts the counted beneficiary list of project / updateproject, "#2" for two
+// beneficiaries and "#" alone for none given
+const LIST_MARK = "#"
+
+// Positional arguments of receivable, before parsing
+type ReceivableArgs struct {
+	ProjectId	string
+	Currency	string
+	Beneficiaries	[]BeneficiaryArgs
+}
+
+// Positional arguments of distribution, before parsing
+type DistributionArgs struct {
+	ProjectId	string
+	IssueAmount	string
+	Currency	string
+	Participants	[]ParticipantArgs
 }
 
 // Record of distribution
 type Distribution struct {
 	ProjectId	string	`json:"project_id"`	// {project_id} + "distribution"
-	Currency	string	`json:"currency"`	// "JPY"
-	IssueRate	float64	`json:"issue_rate"`	// "1"
-	IssueAmount	float64	`json:"issue_amount"`
+	Currency	string	`json:"currency"`	// "JPY" | "USD" | "EUR"
+	IssueRate	Ratio	`json:"issue_rate"`	// rate to REPORTING_CURRENCY
+	IssueAmount	Money	`json:"issue_amount"`	// in Currency
+	ReportingAmount	Money	`json:"reporting_amount"`	// in REPORTING_CURRENCY
 	Issuer		string	`json:"issuer"`		// "FG"
 	IssueYear	uint16	`json:"issue_year"`	// Fiscal Year
-	BKDept		string	`json:"bk_dept"`
-	BKTeam		string	`json:"bk_team"`
-	BKPerson	string	`json:"bk_person"`
-	BKAmount	float64	`json:"bk_amount"`
-	SCDept		string	`json:"sc_dept"`
-	SCTeam		string	`json:"sc_team"`
-	SCPerson	string	`json:"sc_person"`
-	SCAmount	float64	`json:"sc_amount"`
-	TBDept		string	`json:"tb_dept"`
-	TBTeam		string	`json:"tb_team"`
-	TBPerson	string	`json:"tb_person"`
-	TBAmount	float64	`json:"tb_amount"`
+	Participants	[]Participant	`json:"participants"`
+	// Three-slot fields of records written before participants, read by normalize()
+	BKDept		string	`json:"bk_dept,omitempty"`
+	BKTeam		string	`json:"bk_team,omitempty"`
+	BKPerson	string	`json:"bk_person,omitempty"`
+	BKAmount	Money	`json:"bk_amount,omitempty"`
+	SCDept		string	`json:"sc_dept,omitempty"`
+	SCTeam		string	`json:"sc_team,omitempty"`
+	SCPerson	string	`json:"sc_person,omitempty"`
+	SCAmount	Money	`json:"sc_amount,omitempty"`
+	TBDept		string	`json:"tb_dept,omitempty"`
+	TBTeam		string	`json:"tb_team,omitempty"`
+	TBPerson	string	`json:"tb_person,omitempty"`
+	TBAmount	Money	`json:"tb_amount,omitempty"`
+	Stamp
 }
 
 // Record of receivable
 type Receivable struct {
 	ProjectId	string	`json:"project_id"`	// {project_id} + "receivable"
-	Currency	string	`json:"currency"`	// "JPY"
-	AMCPercent	float64	`json:"amc_percent"`
-	AMCAmount	float64	`json:"amc_amount"`
-	GCCPercent	float64	`json:"gcc_percent"`
-	GCCAmount	float64	`json:"gcc_amount"`
-	GMCPercent	float64	`json:"gmc_percent"`
-	GMCAmount	float64	`json:"gmc_amount"`
-	RBBCPercent	float64	`json:"rbbc_percent"`
-	RBBCAmount	float64	`json:"rbbc_amount"`
-	CICPercent	float64	`json:"cic_percent"`
-	CICAmount	float64	`json:"cic_amount"`
+	Currency	string	`json:"currency"`	// "JPY" | "USD" | "EUR"
+	Rate		Ratio	`json:"rate"`		// rate to REPORTING_CURRENCY
+	Beneficiaries	[]BeneficiaryShare	`json:"beneficiaries"`
+	// Fixed fields of records written before beneficiaries, read by normalize()
+	AMCPercent	Ratio	`json:"amc_percent,omitempty"`
+	AMCAmount	Money	`json:"amc_amount,omitempty"`
+	GCCPercent	Ratio	`json:"gcc_percent,omitempty"`
+	GCCAmount	Money	`json:"gcc_amount,omitempty"`
+	GMCPercent	Ratio	`json:"gmc_percent,omitempty"`
+	GMCAmount	Money	`json:"gmc_amount,omitempty"`
+	RBBCPercent	Ratio	`json:"rbbc_percent,omitempty"`
+	RBBCAmount	Money	`json:"rbbc_amount,omitempty"`
+	CICPercent	Ratio	`json:"cic_percent,omitempty"`
+	CICAmount	Money	`json:"cic_amount,omitempty"`
+	Stamp
 }
 
 // Record of project
@@ -73,28 +561,88 @@ type Project struct {
 	ProjectId	string	`json:"project_id"`	// {project_id} + "project"
 	ProjectName	string	`json:"project_name"`
 	InvestType	string	`json:"invest_type"`
-	InvestAmount	float64	`json:"invest_amount"`
-	Confirmed	bool	`json:"confirmed"`	// Yes: true, No: false	
-	AMCPercent	float64	`json:"amc_percent"`
-	GCCPercent	float64	`json:"gcc_percent"`
-	GMCPercent	float64	`json:"gmc_percent"`
-	RBBCPercent	float64	`json:"rbbc_percent"`
-	CICPercent	float64	`json:"cic_percent"`
-	BKDept		string	`json:"bk_dept"`
-	BKTeam		string	`json:"bk_team"`
-	BKPerson	string	`json:"bk_person"`
-	BKAmount	float64	`json:"bk_amount"`
-	BKConfirmed	bool	`json:"bk_confirmed"`	// Yes: true, No: false	
-	SCDept		string	`json:"sc_dept"`
-	SCTeam		string	`json:"sc_team"`
-	SCPerson	string	`json:"sc_person"`
-	SCAmount	float64	`json:"sc_amount"`
-	SCConfirmed	bool	`json:"sc_confirmed"`	// Yes: true, No: false	
-	TBDept		string	`json:"tb_dept"`
-	TBTeam		string	`json:"tb_team"`
-	TBPerson	string	`json:"tb_person"`
-	TBAmount	float64	`json:"tb_amount"`
-	TBConfirmed	bool	`json:"tb_confirmed"`	// Yes: true, No: false
+	InvestAmount	Money	`json:"invest_amount"`
+	Status		string	`json:"status"`	// PROJECT_STATUS_*
+	Confirmed	bool	`json:"confirmed"`	// Yes: true, No: false, kept for old clients
+	Version		uint32	`json:"version"`	// 1, 2, ..., one per write, 0 before versions existed
+	Beneficiaries	[]BeneficiaryShare	`json:"beneficiaries"`
+	Participants	[]Participant	`json:"participants"`
+	// Fixed fields of records written before beneficiaries, read by normalize()
+	AMCPercent	Ratio	`json:"amc_percent,omitempty"`
+	GCCPercent	Ratio	`json:"gcc_percent,omitempty"`
+	GMCPercent	Ratio	`json:"gmc_percent,omitempty"`
+	RBBCPercent	Ratio	`json:"rbbc_percent,omitempty"`
+	CICPercent	Ratio	`json:"cic_percent,omitempty"`
+	// Three-slot fields of records written before participants, read by normalize()
+	BKDept		string	`json:"bk_dept,omitempty"`
+	BKTeam		string	`json:"bk_team,omitempty"`
+	BKPerson	string	`json:"bk_person,omitempty"`
+	BKAmount	Money	`json:"bk_amount,omitempty"`
+	BKConfirmed	bool	`json:"bk_confirmed,omitempty"`	// Yes: true, No: false	
+	SCDept		string	`json:"sc_dept,omitempty"`
+	SCTeam		string	`json:"sc_team,omitempty"`
+	SCPerson	string	`json:"sc_person,omitempty"`
+	SCAmount	Money	`json:"sc_amount,omitempty"`
+	SCConfirmed	bool	`json:"sc_confirmed,omitempty"`	// Yes: true, No: false	
+	TBDept		string	`json:"tb_dept,omitempty"`
+	TBTeam		string	`json:"tb_team,omitempty"`
+	TBPerson	string	`json:"tb_person,omitempty"`
+	TBAmount	Money	`json:"tb_amount,omitempty"`
+	TBConfirmed	bool	`json:"tb_confirmed,omitempty"`	// Yes: true, No: false
+	Stamp
+}
+
+// Change to the allocation of one entity by an amendment
+type AmendmentChange struct {
+	Entity		string	`json:"entity"`
+	OldAmount	Money	`json:"old_amount"`	// 0 if the entity was added
+	NewAmount	Money	`json:"new_amount"`	// 0 if the entity was removed
+	Posted		Money	`json:"posted"`		// moved from the issuer to the entity, negative if moved back
+}
+
+// Record of an update to a project after confirmations, kept under "amendment/{project_id}/{sequence}"
+type Amendment struct {
+	ProjectId	string	`json:"project_id"`
+	Sequence	uint32	`json:"sequence"`	// 1, 2, ...
+	AmendedBy	string	`json:"amended_by"`
+	OldStatus	string	`json:"old_status"`
+	NewStatus	string	`json:"new_status"`
+	Changes		[]AmendmentChange	`json:"changes"`
+	Stamp
+}
+
+// Record of a transfer between two entities, kept under "transfer/{sequence}"
+// with the sequence of its journal entry
+type Transfer struct {
+	Sequence	uint64	`json:"sequence"`
+	TxId		string	`json:"tx_id"`
+	From		string	`json:"from"`
+	To		string	`json:"to"`
+	Amount		Money	`json:"amount"`		// in REPORTING_CURRENCY
+	Reason		string	`json:"reason"`
+	ProjectId	string	`json:"project_id,omitempty"`
+	TransferredBy	string	`json:"transferred_by"`	// a member of From
+	Stamp
+}
+
+// Record of a request processed on behalf of a gateway, kept under "request/{request_id}"
+type ProcessedRequest struct {
+	RequestId	string		`json:"request_id"`	// idempotency key chosen by the gateway
+	Function	string		`json:"function"`
+	Args		[]string	`json:"args"`
+	ProcessedBy	string		`json:"processed_by"`
+	Stamp
+}
+
+// Immutable copy of a project as written, kept under "projectver/{project_id}/{version}"
+type ProjectVersion struct {
+	ProjectId	string	`json:"project_id"`
+	Version		uint32	`json:"version"`
+	TxId		string	`json:"tx_id"`
+	Function	string	`json:"function"`	// Invoke function which wrote the project
+	Caller		string	`json:"caller"`
+	Timestamp	string	`json:"timestamp"`	// RFC3339, from transaction timestamp
+	Project		Project	`json:"project"`
 }
 
 // Record of ranking
@@ -103,6 +651,7 @@ type Ranking struct{
 	Year		uint64	`json:"year"`		// Fiscal Year
 	Rank		uint64	`json:"rank"`
 	URL		string	`json:"url"`
+	Stamp
 }
 
 type ProjectSet struct{
@@ -113,6 +662,14 @@ type IssueSet struct{
 	Issues		[]Issue		`json:"issues"`
 }
 
+// Tranches of a project and their total
+type IssueSummary struct{
+	ProjectId	string	`json:"project_id"`
+	Tranches	[]Issue	`json:"tranches"`
+	TotalAmount	Money	`json:"total_amount"`	// in Currency
+	Currency	string	`json:"currency"`	// REPORTING_CURRENCY
+}
+
 type DistributionSet struct{
 	Distributions	[]Distribution	`json:"distributions"`
 }
@@ -121,65 +678,225 @@ type ReceivableSet struct{
 	Receivables	[]Receivable	`json:"receivables"`
 }
 
+type RateSet struct{
+	Rates		[]Rate		`json:"rates"`
+}
+
+type EntitySet struct{
+	Entities	[]Entity	`json:"entities"`
+}
+
+type AmountSet struct{
+	Amounts		[]Amount	`json:"amounts"`
+}
+
+type BeneficiarySet struct{
+	Beneficiaries	[]Beneficiary	`json:"beneficiaries"`
+}
+
+// Named field of the JSON object form of the arguments of a function
+type ArgSpec struct {
+	Name		string
+	Optional	bool		// may be left out
+	Default		string		// in place of an optional field left out; without one, only trailing fields may be left out
+	Many		bool		// array of values, in order
+	Fields		[]ArgSpec	// array of objects with these fields, in order
+	Counted		bool		// Fields array preceded by LIST_MARK and its length, LIST_MARK alone if left out
+}
+
+// Fields of a participant, in positional order
+var PARTICIPANT_ARGS = []ArgSpec {
+	{ Name: "entity" },
+	{ Name: "dept", Optional: true },
+	{ Name: "team", Optional: true },
+	{ Name: "person", Optional: true },
+	{ Name: "amount" },
+}
+
+// Fields of project / updateproject, in the positional order of the counted form
+var PROJECT_ARGS = []ArgSpec {
+	{ Name: "project_id" },
+	{ Name: "project_name" },
+	{ Name: "invest_type" },
+	{ Name: "invest_amount" },
+	{ Name: "beneficiaries", Optional: true, Counted: true, Fields: []ArgSpec { { Name: "code" }, { Name: "percent" } } },
+	{ Name: "participants", Fields: PARTICIPANT_ARGS },
+}
+
+// Fields of the JSON object form of each Invoke function, in positional order
+var INVOKE_ARGS = map[string][]ArgSpec {
+	"issue":			{ { Name: "project_id" }, { Name: "amount" }, { Name: "currency", Optional: true } },
+	"project":			PROJECT_ARGS,
+	"updateproject":		PROJECT_ARGS,
+	"receivable":			{ { Name: "project_id" }, { Name: "currency" }, { Name: "beneficiaries", Fields: []ArgSpec {
+					  { Name: "code" }, { Name: "percent", Optional: true, Default: "0" }, { Name: "amount", Optional: true, Default: "0" } } } },
+	"distribution":			{ { Name: "project_id" }, { Name: "issue_amount" }, { Name: "currency" }, { Name: "participants", Fields: PARTICIPANT_ARGS } },
+	"confirm":			{ { Name: "project_id" }, { Name: "entity" }, { Name: "request_id", Optional: true } },
+	"submit":			{ { Name: "project_id" } },
+	"close":			{ { Name: "project_id" } },
+	"cancel":			{ { Name: "project_id" } },
+	"reopen":			{ { Name: "project_id" } },
+	"reject":			{ { Name: "project_id" }, { Name: "entity" }, { Name: "reason" } },
+	"unconfirm":			{ { Name: "project_id" }, { Name: "entity" }, { Name: "reason" } },
+	"ranking":			{ { Name: "year", Optional: true }, { Name: "person" }, { Name: "rank" }, { Name: "url" } },
+	"reverse_issue":		{ { Name: "project_id" }, { Name: "tranche" }, { Name: "amount" }, { Name: "reason" } },
+	"cancel_issue":			{ { Name: "project_id" }, { Name: "tranche" }, { Name: "reason" } },
+	"transfer":			{ { Name: "from" }, { Name: "to" }, { Name: "amount" }, { Name: "reason" },
+					  { Name: "project_id", Optional: true }, { Name: "request_id", Optional: true } },
+	"register_entity":		{ { Name: "code" }, { Name: "name" }, { Name: "role" } },
+	"rename_entity":		{ { Name: "code" }, { Name: "name" } },
+	"deactivate_entity":		{ { Name: "code" } },
+	"add_entity_member":		{ { Name: "code" }, { Name: "user" } },
+	"remove_entity_member":		{ { Name: "code" }, { Name: "user" } },
+	"patch_project":		{ { Name: "project_id" }, { Name: "changes", Fields: []ArgSpec { { Name: "field" }, { Name: "value" } } } },
+	"set_project_beneficiaries":	{ { Name: "project_id" }, { Name: "beneficiaries", Fields: []ArgSpec { { Name: "code" }, { Name: "percent" } } } },
+	"register_beneficiary":		{ { Name: "code" }, { Name: "name" } },
+	"rename_beneficiary":		{ { Name: "code" }, { Name: "name" } },
+	"retire_beneficiary":		{ { Name: "code" } },
+	"open_journal":			{},
+	"close_fiscal_year":		{ { Name: "year" } },
+	"set_reservation_policy":	{ { Name: "enabled" } },
+	"set_validation_mode":		{ { Name: "mode" } },
+	"set_rounding_mode":		{ { Name: "rounding" } },
+	"migrate_money":		{},
+	"set_consistency_rules":	{ { Name: "tolerance" }, { Name: "percent_tolerance", Optional: true }, { Name: "rules", Optional: true, Many: true } },
+	"set_rate":			{ { Name: "currency" }, { Name: "rate" } },
+	"set_budget":			{ { Name: "entity" }, { Name: "year" }, { Name: "cap" } },
+	"set_fiscal_calendar":		{ { Name: "start_month" }, { Name: "year_label" }, { Name: "time_zone" }, { Name: "utc_offset" },
+					  { Name: "quarters", Optional: true, Many: true } },
+	"grant_role":			{ { Name: "user" }, { Name: "role" } },
+}
+
+// Fields of the JSON object form of each Query function, in positional order
+var QUERY_ARGS = map[string][]ArgSpec {
+	"get_current_amount":		{ { Name: "entity" }, { Name: "year", Optional: true } },
+	"get_project":			{ { Name: "project_id" } },
+	"get_project_history":		{ { Name: "project_id" } },
+	"get_project_at_version":	{ { Name: "project_id" }, { Name: "version" } },
+	"get_amendments":		{ { Name: "project_id" } },
+	"get_all_transfer":		{ { Name: "entity", Optional: true } },
+	"get_issue":			{ { Name: "project_id" } },
+	"get_distribution":		{ { Name: "project_id" } },
+	"get_receivable":		{ { Name: "project_id" } },
+	"get_ranking":			{ { Name: "year", Optional: true }, { Name: "person" } },
+	"get_all_project":		{ { Name: "status", Optional: true } },
+	"get_all_issue":		{ { Name: "year", Optional: true } },
+	"get_all_distribution":		{ { Name: "year", Optional: true } },
+	"get_all_receivable":		{},
+	"get_rate":			{ { Name: "currency" } },
+	"get_all_rate":			{},
+	"get_budget_status":		{ { Name: "entity" }, { Name: "year", Optional: true } },
+	"get_entity":			{ { Name: "code" } },
+	"get_all_entity":		{},
+	"get_all_amount":		{},
+	"get_beneficiary":		{ { Name: "code" } },
+	"get_all_beneficiary":		{},
+	"get_reservation_policy":	{},
+	"get_reservation":		{ { Name: "project_id" } },
+	"get_validation_mode":		{},
+	"get_rounding_mode":		{},
+	"get_consistency_rules":	{},
+	"validate_project":		{ { Name: "project_id", Optional: true } },
+	"get_amount_history":		{ { Name: "entity" }, { Name: "year", Optional: true }, { Name: "from", Optional: true }, { Name: "to", Optional: true } },
+	"audit_ledger":			{},
+	"get_journal":			{ { Name: "account", Optional: true } },
+	"get_journal_entry":		{ { Name: "sequence" } },
+	"verify_journal":		{},
+	"get_fiscal_calendar":		{},
+	"get_fiscal_period":		{ { Name: "date", Optional: true } },
+}
+
 //
 // Init
 //
 func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
-	fmt.Println("Entering into Init()" + function)
+	return t.init_ledger(ShimStub{stub}, function, args)
+}
 
-	var amount_record Amount
+//
+// Invoke
+//
+func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return t.invoke(ShimStub{stub}, function, args)
+}
 
-	// making a record
-	amount_record = Amount {
-		Entity:	"FG",
-		Amount:	0,
-	}
-	bytes, err := json.Marshal(amount_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
-	}
-	err = stub.PutState("FG", []byte(bytes))
+//
+// Query callback representing the query of a chaincode
+//
+func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return t.query(ShimStub{stub}, function, args)
+}
+
+//
+// init_ledger
+//
+func (t *SimpleChaincode) init_ledger(stub LedgerStub, function string, args []string) ([]byte, error) {
+	fmt.Println("Entering into Init()" + function)
+
+	now, err := t.get_tx_time(stub)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+		return nil, err
 	}
+	tx_id := stub.GetTxID()
 
-	amount_record = Amount {
-		Entity:	"BK",
-		Amount:	0,
+	// Entities known before the registry existed, each starting from 0
+	default_entities := []Entity {
+		{ Code: "FG", Name: "FG", Role: ENTITY_ROLE_ISSUER, Active: true },
+		{ Code: "BK", Name: "BK", Role: ENTITY_ROLE_PARTICIPANT, Active: true },
+		{ Code: "SC", Name: "SC", Role: ENTITY_ROLE_PARTICIPANT, Active: true },
+		{ Code: "TB", Name: "TB", Role: ENTITY_ROLE_PARTICIPANT, Active: true },
 	}
-	bytes, err = json.Marshal(amount_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
+	for _, entity_record := range default_entities {
+		err = t.put_entity(stub, entity_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+		amount_record := Amount {
+			Entity:		entity_record.Code,
+			Amount:		0,
+			Currency:	REPORTING_CURRENCY,
+		}
+		err = t.put_amount(stub, amount_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
 	}
-	err = stub.PutState("BK", []byte(bytes))
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+
+	// Beneficiaries known before the registry existed
+	for _, code := range LEGACY_BENEFICIARIES {
+		err = t.put_beneficiary(stub, Beneficiary{Code: code, Name: code, Active: true}, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	amount_record = Amount {
-		Entity:	"SC",
-		Amount:	0,
+	// Reporting currency always converts at 1
+	rate_record := Rate {
+		Currency:	REPORTING_CURRENCY,
+		Rate:		RATIO_UNIT,
+		UpdatedBy:	"Init",
 	}
-	bytes, err = json.Marshal(amount_record)
+	rate_record.touch(now, tx_id)
+	bytes, err := json.Marshal(rate_record)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
+		return nil, errors.New("##### OpeEx1: Error creating new Rate record #####")
 	}
-	err = stub.PutState("SC", []byte(bytes))
+	err = stub.PutState("rate/" + REPORTING_CURRENCY, []byte(bytes))
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+		return nil, errors.New("##### OpeEx1: Unable to put the state for Rate #####")
 	}
 
-	amount_record = Amount {
-		Entity:	"TB",
-		Amount:	0,
-	}
-	bytes, err = json.Marshal(amount_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
+	// Administrators: the deploying user and any user names passed as args
+	admins := args
+	user, err := t.get_username(stub)
+	if err == nil {
+		admins = append(admins, user)
 	}
-	err = stub.PutState("TB", []byte(bytes))
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+	for _, admin := range admins {
+		err = t.grant_role(stub, admin, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Nothing to do here, just return
@@ -188,9 +905,9 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 }
 
 //
-// Invoke
+// invoke
 //
-func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) invoke(stub LedgerStub, function string, args []string) ([]byte, error) {
 	var err		error
 	fmt.Println("Entering into Invoke: " + function)
 	user, err := t.get_username(stub)
@@ -198,63 +915,100 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		return nil, errors.New("##### OpeEx1: Failed to get username for function: " + function + " #####")
 	}
 	fmt.Println("Invoke function called by : " + user)
+
+	// Every write takes its time from the transaction, never from the peer clock,
+	// so that all endorsing peers produce the same state
+	now, err := t.get_tx_time(stub)
+	if err != nil {
+		return nil, err
+	}
+	tx_id := stub.GetTxID()
+
+	// Every function also takes one JSON object with the fields of INVOKE_ARGS
+	args, err = t.named_args(function, args, INVOKE_ARGS)
+	if err != nil {
+		return nil, err
+	}
 	
 	if function == "issue" {			// issue //0
-		// (ProjectId, Issueamount)
+		// (ProjectId, Issueamount [, Currency])
 		fmt.Println("Entering into issue")
-		if len(args) != 2 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for issue #####")
+		if len(args) != 2 && len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 or 3 arguments for issue #####")
 		}
 
-		// String to Float64
-		var issue_amount	float64
+		// String to Money
+		var issue_amount	Money
 		var project_id		string
+		var currency		string
+		var issue_rate		Ratio
 
-		// Check if the issue has already been registered
+		// Each issue adds the next tranche to the project
 		project_id = args[0]
-		issue_key :=  "issue/" + project_id
 		fmt.Printf("Invoke (issue): project_id = %s\n", project_id)
-
-		fmt.Println("Calling GetState in issue")
-		issue_asbytes, err := stub.GetState(issue_key)
+		err = check_project_id(project_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+			return nil, err
 		}
-		fmt.Println("Success GetState in issue")
-		if issue_asbytes != nil {
-			return nil, errors.New("##### OpeEx1: key: " + issue_key + " has already been registered #####")
+
+		fmt.Println("Calling get_issue_tranches in issue")
+		tranches, err := t.get_issue_tranches(stub, project_id)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Println("New issue record will be added")
+		tranche := uint32(len(tranches) + 1)
+		issue_key := t.issue_key(project_id, tranche)
+		fmt.Printf("Invoke (issue): new tranche %d will be added\n", tranche)
 
 		// Set Arguments to local variables
-		issue_amount, err = strconv.ParseFloat(args[1], 64)
+		issue_amount, err = parse_money(args[1])
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Expecting float value for issue_amount to be issued #####")
+			return nil, errors.New("##### OpeEx1: Expecting decimal value for issue_amount to be issued #####")
+		}
+		fmt.Printf("Invoke (issue): issue_amount = %s\n", issue_amount)
+		currency = REPORTING_CURRENCY
+		if len(args) == 3 {
+			currency = args[2]
+		}
+		currency, issue_rate, err = t.get_rate(stub, currency)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Invoke (issue): currency = %s, issue_rate = %s\n", currency, issue_rate)
+		money_config, err := t.get_money_config(stub)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("Invoke (issue): issue_amount = %f\n", issue_amount)
-
-		// Get current date and time
-		t := time.Now()
 
-		// making a Issue record
-		var year	uint16
-		var month 	uint8
-		year =		uint16(t.Year())
-		month =		uint8(t.Month())
-		if month < 4 {
-			year = year + 1
+		// Get fiscal year of current date and time
+		calendar, err := t.get_fiscal_calendar(stub)
+		if err != nil {
+			return nil, err
+		}
+		year := calendar.fiscal_year(now)
+		issuer, err := t.get_issuer(stub)
+		if err != nil {
+			return nil, err
+		}
+		reporting_amount, err := issue_amount.convert(issue_rate, money_config.Rounding)
+		if err != nil {
+			return nil, err
 		}
 
 		// Add new issue_record
 		var issue_record Issue
 		issue_record = Issue {
 			ProjectId:	project_id,
-			Currency:	"JPY",
-			IssueRate:	1,
+			Tranche:	tranche,
+			Kind:		ISSUE_KIND_ISSUE,
+			Currency:	currency,
+			IssueRate:	issue_rate,
 			IssueAmount:	issue_amount,
-			Issuer:		"FG",
+			ReportingAmount:	reporting_amount,
+			Issuer:		issuer,
 			IssueYear:	year,
 		}
+		issue_record.touch(now, tx_id)
 		bytes, err := json.Marshal(issue_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error creating new Issue record #####")
@@ -264,64 +1018,46 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 			return nil, errors.New("##### OpeEx1: Unable to put the state for Issue #####")
 		}
 
-		// Get current amount
-		amount_asbytes, err := stub.GetState("FG")
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for FG #####")
-		}
-		var amount_record Amount
-		err = json.Unmarshal(amount_asbytes, &amount_record)
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(amount_asbytes) + " #####")
-		}
-		fmt.Printf("Invoke (issue): current_amount for FG = %f\n", amount_record.Amount)
-
-		// Add new amount to current_amount
-		amount_record.Amount = amount_record.Amount + issue_amount
-		fmt.Printf("Invoke (issue): new_amount for FG = %f\n", amount_record.Amount)
-
-		// update amount_record
-		bytes, err = json.Marshal(amount_record)
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
-		}
-		err = stub.PutState("FG", []byte(bytes))
+		// Add new amount to current_amount of the issuer, always in REPORTING_CURRENCY
+		err = t.post(stub, function, project_id, issuer, ACCOUNT_ISSUE, issue_record.ReportingAmount, now, tx_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+			return nil, err
 		}
 		
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "project" {		// project //
+		// (ProjectId, ProjectName, InvestType, InvestAmount,
+		//  "#" + N, Code, Percent, [Code, Percent, ...],
+		//  Entity, Dept, Team, Person, Amount, [Entity, Dept, Team, Person, Amount, ...])
+		// or the five fixed beneficiaries
+		// (ProjectId, ProjectName, InvestType, InvestAmount,
+		//  AMCPercent, GCCPercent, GMCPercent, RBBCPercent, CICPercent,
+		//  Entity, Dept, Team, Person, Amount, [Entity, Dept, Team, Person, Amount, ...])
+		// Amount NOT_PARTICIPATING ("-") leaves an entity out
+		// or the three-slot form
 		// (ProjectId, ProjectName, InvestType, InvestAmount,
 		//  AMCPercent, GCCPercent, GMCPercent, RBBCPercent, CICPercent,
 		//  BKDept, BKTeam, BKPerson, BKAmount,
 		//  SCDept, SCTeam, SCPerson, SCAmount,
 		//  TBDept, TBTeam, TBPerson, TBAmount)
 		fmt.Println("Entering into project")
-		if len(args) != 21 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 21 arguments for project #####")
+		project_args, err := t.parse_project_args(args)
+		if err != nil {
+			return nil, err
+		}
+		err = check_project_id(project_args.ProjectId)
+		if err != nil {
+			return nil, err
 		}
-
-		// String to Float64
-		var project_id, project_name, invest_type				string
-		var invest_amount							float64
-		var amc_percent, gcc_percent, gmc_percent, rbbc_percent, cic_percent	float64
-		var bk_dept, bk_team, bk_person						string
-		var sc_dept, sc_team, sc_person						string
-		var tb_dept, tb_team, tb_person						string
-		var bk_amount, sc_amount, tb_amount					float64
-		var bk_confirmed, sc_confirmed, tb_confirmed				bool
-		var err			error
 
 		// Check if the project has already been registered
-		project_id =	args[0]
-		project_key := "project/" + project_id 
+		project_key := "project/" + project_args.ProjectId
 		
 		fmt.Println("Calling GetState in project")
 		project_asbytes, err := stub.GetState(project_key)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_args.ProjectId + " #####")
 		}
 		fmt.Println("Success GetState in project")
 		if project_asbytes != nil {
@@ -329,307 +1065,133 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		}
 		fmt.Println("New project record will be added")
 		
-		// Set Arguments to local variables
-		project_name = 	args[1]
-		invest_type = 	args[2]
-		invest_amount, err = strconv.ParseFloat(args[3], 64)
-		if err != nil {
-			invest_amount = 0
-		}
-		amc_percent, err = strconv.ParseFloat(args[4], 64)
-		if err != nil {
-			amc_percent = 0
-		}
-		gcc_percent, err = strconv.ParseFloat(args[5], 64)
-		if err != nil {
-			gcc_percent = 0
-		}
-		gmc_percent, err = strconv.ParseFloat(args[6], 64)
+		// making a Project record
+		project_record, err := t.make_project(stub, project_args, nil)
 		if err != nil {
-			gmc_percent = 0
+			return nil, err
 		}
-		rbbc_percent, err = strconv.ParseFloat(args[7], 64)
+		reservation_config, err := t.get_reservation_config(stub)
 		if err != nil {
-			rbbc_percent = 0
+			return nil, err
 		}
-		cic_percent, err = strconv.ParseFloat(args[8], 64)
-		if err != nil {
-			cic_percent = 0
+		if reservation_config.Enabled {
+			// save_project holds the funds
+			issuer, err := t.get_issuer(stub)
+			if err != nil {
+				return nil, err
+			}
+			err = t.put_reservation(stub, Reservation{ProjectId: project_record.ProjectId, Entity: issuer}, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
 		}
-		bk_dept = 	args[9]
-		bk_team = 	args[10]
-		bk_person = 	args[11]
-		bk_amount, err = strconv.ParseFloat(args[12], 64)
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
 		if err != nil {
-			bk_amount = 0
-			bk_confirmed = true
-		}		
-		sc_dept = 	args[13]
-		sc_team = 	args[14]
-		sc_person = 	args[15]
-		sc_amount, err = strconv.ParseFloat(args[16], 64)
-		if err != nil {
-			sc_amount = 0
-			sc_confirmed = true
-		}		
-		tb_dept = 	args[17]
-		tb_team = 	args[18]
-		tb_person = 	args[19]
-		tb_amount, err = strconv.ParseFloat(args[20], 64)
-		if err != nil {
-			tb_amount = 0
-			tb_confirmed = true
-		}		
-		
-		// making a Project record
-		var project_record Project
-		project_record = Project {
-			ProjectId:	project_id,
-			ProjectName:	project_name,
-			InvestType:	invest_type,
-			InvestAmount:	invest_amount,
-			Confirmed:	false,
-			AMCPercent:	amc_percent,
-			GCCPercent:	gcc_percent,
-			GMCPercent:	gmc_percent,
-			RBBCPercent:	rbbc_percent,
-			CICPercent:	cic_percent,
-			BKDept:		bk_dept,
-			BKTeam:		bk_team,
-			BKPerson:	bk_person,
-			BKAmount:	bk_amount,
-			BKConfirmed:	bk_confirmed,	
-			SCDept:		sc_dept,
-			SCTeam:		sc_team,
-			SCPerson:	sc_person,
-			SCAmount:	sc_amount,
-			SCConfirmed:	sc_confirmed,	
-			TBDept:		tb_dept,
-			TBTeam:		tb_team,
-			TBPerson:	tb_person,
-			TBAmount:	tb_amount,
-			TBConfirmed:	tb_confirmed,
-		}
-		bytes, err := json.Marshal(project_record)
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error on creating new Project record #####")
-		}
-		err = stub.PutState(project_key, []byte(bytes))
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state for Project #####")
+			return nil, err
 		}
 
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "updateproject" {		// updateproject //
-		// (ProjectId, ProjectName, InvestType, InvestAmount,
-		//  AMCPercent, GCCPercent, GMCPercent, RBBCPercent, CICPercent,
-		//  BKDept, BKTeam, BKPerson, BKAmount,
-		//  SCDept, SCTeam, SCPerson, SCAmount,
-		//  TBDept, TBTeam, TBPerson, TBAmount)
+		// Same arguments as project; beneficiaries not given, or besides the five
+		// fixed ones, are kept as they are
+		// Confirmations are kept for entities still allocated; once confirmed, the
+		// change in their amount is posted between the issuer and the entity
+		// A reject or unconfirm is kept, with its reason, until the amount changes
 		fmt.Println("Entering into updateproject, forcibly update project")
-		if len(args) != 21 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 21 arguments for project #####")
+		project_args, err := t.parse_project_args(args)
+		if err != nil {
+			return nil, err
 		}
 
-		// String to Float64
-		var project_id, project_name, invest_type				string
-		var invest_amount							float64
-		var amc_percent, gcc_percent, gmc_percent, rbbc_percent, cic_percent	float64
-		var bk_dept, bk_team, bk_person						string
-		var sc_dept, sc_team, sc_person						string
-		var tb_dept, tb_team, tb_person						string
-		var bk_amount, sc_amount, tb_amount					float64
-		var bk_confirmed, sc_confirmed, tb_confirmed				bool
-		var err			error
-
 		// Check if the project has already been registered
-		project_id =	args[0]
-		project_key := "project/" + project_id 
+		project_key := "project/" + project_args.ProjectId
 		
 		fmt.Println("Calling GetState in project")
 		project_asbytes, err := stub.GetState(project_key)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_args.ProjectId + " #####")
 		}
 		fmt.Println("Success GetState in project")
 		if project_asbytes == nil {
 			return nil, errors.New("##### OpeEx1: key: " + project_key + " has not been registered #####")
 		}
-		fmt.Println("Project record will be override")
-		
-		// Set Arguments to local variables
-		project_name = 	args[1]
-		invest_type = 	args[2]
-		invest_amount, err = strconv.ParseFloat(args[3], 64)
+		current_record, err := t.load_project(stub, project_args.ProjectId)
 		if err != nil {
-			invest_amount = 0
+			return nil, err
 		}
-		amc_percent, err = strconv.ParseFloat(args[4], 64)
-		if err != nil {
-			amc_percent = 0
+		if current_record.Status == PROJECT_STATUS_CLOSED || current_record.Status == PROJECT_STATUS_CANCELLED {
+			return nil, errors.New("##### OpeEx1: project_id: " + project_args.ProjectId + " is " + current_record.Status + " and can no longer be updated #####")
 		}
-		gcc_percent, err = strconv.ParseFloat(args[5], 64)
+		fmt.Println("Project record will be override")
+		
+		// making a Project record
+		project_record, err := t.make_project(stub, project_args, current_record.Beneficiaries)
 		if err != nil {
-			gcc_percent = 0
+			return nil, err
 		}
-		gmc_percent, err = strconv.ParseFloat(args[6], 64)
-		if err != nil {
-			gmc_percent = 0
+		project_record.Status = current_record.Status
+		project_record.keep_rejections(current_record)
+		if current_record.has_confirmations() {
+			// Balances have moved already, post the differences and record an amendment
+			err = t.amend_project(stub, current_record, &project_record, function, user, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
 		}
-		rbbc_percent, err = strconv.ParseFloat(args[7], 64)
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
 		if err != nil {
-			rbbc_percent = 0
-		}
-		cic_percent, err = strconv.ParseFloat(args[8], 64)
-		if err != nil {
-			cic_percent = 0
-		}
-		bk_dept = 	args[9]
-		bk_team = 	args[10]
-		bk_person = 	args[11]
-		bk_amount, err = strconv.ParseFloat(args[12], 64)
-		if err != nil {
-			bk_amount = 0
-			bk_confirmed = true
-		}		
-		sc_dept = 	args[13]
-		sc_team = 	args[14]
-		sc_person = 	args[15]
-		sc_amount, err = strconv.ParseFloat(args[16], 64)
-		if err != nil {
-			sc_amount = 0
-			sc_confirmed = true
-		}		
-		tb_dept = 	args[17]
-		tb_team = 	args[18]
-		tb_person = 	args[19]
-		tb_amount, err = strconv.ParseFloat(args[20], 64)
-		if err != nil {
-			tb_amount = 0
-			tb_confirmed = true
-		}		
-		
-		// making a Project record
-		var project_record Project
-		project_record = Project {
-			ProjectId:	project_id,
-			ProjectName:	project_name,
-			InvestType:	invest_type,
-			InvestAmount:	invest_amount,
-			Confirmed:	false,
-			AMCPercent:	amc_percent,
-			GCCPercent:	gcc_percent,
-			GMCPercent:	gmc_percent,
-			RBBCPercent:	rbbc_percent,
-			CICPercent:	cic_percent,
-			BKDept:		bk_dept,
-			BKTeam:		bk_team,
-			BKPerson:	bk_person,
-			BKAmount:	bk_amount,
-			BKConfirmed:	bk_confirmed,	
-			SCDept:		sc_dept,
-			SCTeam:		sc_team,
-			SCPerson:	sc_person,
-			SCAmount:	sc_amount,
-			SCConfirmed:	sc_confirmed,	
-			TBDept:		tb_dept,
-			TBTeam:		tb_team,
-			TBPerson:	tb_person,
-			TBAmount:	tb_amount,
-			TBConfirmed:	tb_confirmed,
-		}
-		bytes, err := json.Marshal(project_record)
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error on creating new Project record #####")
-		}
-		err = stub.PutState(project_key, []byte(bytes))
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state for Project #####")
+			return nil, err
 		}
 
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "receivable" {		// receivable //
+		// (ProjectId, Currency, Code, Percent, Amount, [Code, Percent, Amount, ...])
+		// or the fixed form
 		// (ProjectId, AMCPercent, AMCAmount,
 		//  GCCPercent, GCCAmount, GMCPercent, GMCAmount,
-		//  RBBCPercent, RBBCAmount, CICPercent, CICAmount)
+		//  RBBCPercent, RBBCAmount, CICPercent, CICAmount [, Currency])
 		fmt.Println("Entering into receivable")
-		if len(args) != 11 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 11 arguments for receivable #####")
+		receivable_args, err := t.parse_receivable_args(args)
+		if err != nil {
+			return nil, err
 		}
 
-		// String to Float64
-		var project_id						string
-		var amc_percent, amc_amount, gcc_percent, gcc_amount	float64
-		var gmc_percent, gmc_amount, rbbc_percent, rbbc_amount	float64
-		var cic_percent, cic_amount				float64
-		var err							error
-
 		// Set Arguments to local variables
-		project_id =	args[0]
-		amc_percent, err = strconv.ParseFloat(args[1], 64)
-		if err != nil {
-			amc_percent = 0
-		}
-		amc_amount, err = strconv.ParseFloat(args[2], 64)
-		if err != nil {
-			amc_amount = 0
-		}
-		gcc_percent, err = strconv.ParseFloat(args[3], 64)
-		if err != nil {
-			gcc_percent = 0
-		}
-		gcc_amount, err = strconv.ParseFloat(args[4], 64)
-		if err != nil {
-			gcc_amount = 0
-		}
-		gmc_percent, err = strconv.ParseFloat(args[5], 64)
-		if err != nil {
-			gmc_percent = 0
-		}
-		gmc_amount, err = strconv.ParseFloat(args[6], 64)
-		if err != nil {
-			gmc_amount = 0
-		}
-		rbbc_percent, err = strconv.ParseFloat(args[7], 64)
-		if err != nil {
-			rbbc_percent = 0
-		}
-		rbbc_amount, err = strconv.ParseFloat(args[8], 64)
+		project_id := receivable_args.ProjectId
+		currency, rate, err := t.get_rate(stub, receivable_args.Currency)
 		if err != nil {
-			rbbc_amount = 0
+			return nil, err
 		}
-		cic_percent, err = strconv.ParseFloat(args[9], 64)
+		v, err := t.get_validator(stub)
 		if err != nil {
-			cic_percent = 0
+			return nil, err
 		}
-		cic_amount, err = strconv.ParseFloat(args[10], 64)
+		beneficiaries := t.make_beneficiary_shares(stub, v, receivable_args.Beneficiaries, true)
+		err = v.error()
 		if err != nil {
-			cic_amount = 0
+			return nil, err
 		}
 		
 		// making a Receivable record
 		var receivable_record Receivable
 		receivable_record = Receivable {
 			ProjectId:	project_id,
-			Currency:	"JPY",
-			AMCPercent:	amc_percent,
-			AMCAmount:	amc_amount,
-			GCCPercent:	gcc_percent,
-			GCCAmount:	gcc_amount,
-			GMCPercent:	gmc_percent,
-			GMCAmount:	gmc_amount,
-			RBBCPercent:	rbbc_percent,
-			RBBCAmount:	rbbc_amount,
-			CICPercent:	cic_percent,
-			CICAmount:	cic_amount,
+			Currency:	currency,
+			Rate:		rate,
+			Beneficiaries:	beneficiaries,
+		}
+		receivable_key := "receivable/" + project_id 
+		receivable_record.Stamp, err = t.get_stamp(stub, receivable_key)
+		if err != nil {
+			return nil, err
 		}
+		receivable_record.touch(now, tx_id)
 		bytes, err := json.Marshal(receivable_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error on creating new Receivable record #####")
 		}
-		receivable_key := "receivable/" + project_id 
 		err = stub.PutState(receivable_key, []byte(bytes))
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Unable to put the state for Receivable #####")
@@ -638,77 +1200,80 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "distribution" {		// distribution //
+		// (ProjectId, IssueAmount, Currency,
+		//  Entity, Dept, Team, Person, Amount, [Entity, Dept, Team, Person, Amount, ...])
+		// or the three-slot form
 		// (ProjectId, IssueAmount,
 		//  BKDept, BKTeam, BKPerson, BKAmount,
 		//  SCDept, SCTeam, SCPerson, SCAmount,
-		//  TBDept, TBTeam, TBPerson, TBAmount)
+		//  TBDept, TBTeam, TBPerson, TBAmount [, Currency])
+		// Amount NOT_PARTICIPATING ("-") leaves an entity out
 		fmt.Println("Entering into distribution")
-		if len(args) != 14 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 14 arguments for distribution #####")
+		distribution_args, err := t.parse_distribution_args(args)
+		if err != nil {
+			return nil, err
 		}
 
-		// String to Float64
-		var project_id						string
-		var issue_amount, bk_amount, sc_amount, tb_amount	float64
-		var bk_dept, bk_team, bk_person				string
-		var sc_dept, sc_team, sc_person				string
-		var tb_dept, tb_team, tb_person				string
-		var err															error
+		// String to Money
+		var issue_amount	Money
+		var issue_rate		Ratio
+		var currency		string
 
 		// Set Arguments to local variables
-		project_id =	args[0]
-		issue_amount, err = strconv.ParseFloat(args[1], 64)
+		project_id := distribution_args.ProjectId
+		v, err := t.get_validator(stub)
+		if err != nil {
+			return nil, err
+		}
+		issue_amount = v.amount("issue_amount", distribution_args.IssueAmount)
+		participants := t.make_participants(stub, v, distribution_args.Participants)
+		err = v.error()
+		if err != nil {
+			return nil, err
+		}
+		currency, issue_rate, err = t.get_rate(stub, distribution_args.Currency)
+		if err != nil {
+			return nil, err
+		}
+		money_config, err := t.get_money_config(stub)
 		if err != nil {
-			issue_amount = 0
+			return nil, err
 		}
-		bk_dept =		args[2]
-		bk_team =		args[3]
-		bk_person =		args[4]
-		bk_amount, err = strconv.ParseFloat(args[5], 64)
+		calendar, err := t.get_fiscal_calendar(stub)
 		if err != nil {
-			bk_amount = 0
+			return nil, err
 		}
-		sc_dept =		args[6]
-		sc_team =		args[7]
-		sc_person =		args[8]
-		sc_amount, err = strconv.ParseFloat(args[9], 64)
+		issuer, err := t.get_issuer(stub)
 		if err != nil {
-			sc_amount = 0
+			return nil, err
 		}
-		tb_dept =		args[10]
-		tb_team =		args[11]
-		tb_person =		args[12]
-		tb_amount, err = strconv.ParseFloat(args[13], 64)
+		reporting_amount, err := issue_amount.convert(issue_rate, money_config.Rounding)
 		if err != nil {
-			tb_amount = 0
+			return nil, err
 		}
 		
 		// making a Distribution record
 		var distribution_record Distribution
 		distribution_record = Distribution {
 			ProjectId:	project_id,
-			Currency:	"JPY",
-			IssueRate:	1,
+			Currency:	currency,
+			IssueRate:	issue_rate,
 			IssueAmount:	issue_amount,
-			Issuer:	"FG",
-			BKDept:	bk_dept,
-			BKTeam:	bk_team,
-			BKPerson:	bk_person,
-			BKAmount:	bk_amount,
-			SCDept:	sc_dept,
-			SCTeam:	sc_team,
-			SCPerson:	sc_person,
-			SCAmount:	sc_amount,
-			TBDept:	tb_dept,
-			TBTeam:	tb_team,
-			TBPerson:	tb_person,
-			TBAmount:	tb_amount,
+			ReportingAmount:	reporting_amount,
+			Issuer:		issuer,
+			IssueYear:	calendar.fiscal_year(now),
+			Participants:	participants,
+		}
+		distribution_key := "distribution/" + project_id 
+		distribution_record.Stamp, err = t.get_stamp(stub, distribution_key)
+		if err != nil {
+			return nil, err
 		}
+		distribution_record.touch(now, tx_id)
 		bytes, err := json.Marshal(distribution_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error on creating new Distribution record #####")
 		}
-		distribution_key := "distribution/" + project_id 
 		err = stub.PutState(distribution_key, []byte(bytes))
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Unable to put the state for Distribution #####")
@@ -717,165 +1282,219 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "confirm" {		// confirm //
-		// (ProjectId, Entity)
+		// (ProjectId, Entity [, RequestId])
+		// Confirming an entity again is a no-op, and so is a RequestId seen before;
+		// a draft is submitted by its first confirm, as clients written before drafts
+		// existed confirm straight after project
 		fmt.Println("Entering into confirm")
-		if len(args) != 2 {
-			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for confirm #####")
+		if len(args) != 2 && len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 or 3 arguments for confirm #####")
+		}
+		if len(args) == 3 {
+			processed, err := t.check_request(stub, args[2], function, args[:2])
+			if err != nil {
+				return nil, err
+			}
+			if processed {
+				fmt.Println("Returning from Invoke: " + function)
+				return nil, nil
+			}
+			err = t.put_request(stub, args[2], function, args[:2], user, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		// Get the state from the ledger
-		var project_record Project
 		project_id := args[0]
-		project_key := "project/" + args[0]
 
-		fmt.Println("Calling GetState in confirm")
-		project_asbytes, err := stub.GetState(project_key)
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
-		}
-		if project_asbytes == nil {
-			return nil, errors.New("##### OpeEx1: project_id: " + project_id + " was not found #####")
-		}
-
-		fmt.Println("Calling Unmarshal in confirm")
-		err = json.Unmarshal(project_asbytes, &project_record)
+		fmt.Println("Calling load_project in confirm")
+		project_record, err := t.load_project(stub, project_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+			return nil, err
 		}
 		fmt.Printf("Invoke (confirm): project_id = %s\n",	project_id)
 		fmt.Printf("Invoke (confirm): project_name = %s\n",	project_record.ProjectName)
-		fmt.Printf("Invoke (confirm): confirmed = %t\n",	project_record.Confirmed)
+		fmt.Printf("Invoke (confirm): status = %s\n",		project_record.Status)
 		fmt.Printf("Invoke (confirm): invest_type = %s\n",	project_record.InvestType)
-		fmt.Printf("Invoke (confirm): invest_amount = %f\n",	project_record.InvestAmount)
-		fmt.Printf("Invoke (confirm): amc_percent = %f\n",	project_record.AMCPercent)
-		fmt.Printf("Invoke (confirm): gcc_percent = %f\n",	project_record.GCCPercent)
-		fmt.Printf("Invoke (confirm): gmc_percent = %f\n",	project_record.GMCPercent)
-		fmt.Printf("Invoke (confirm): rbbc_percent = %f\n",	project_record.RBBCPercent)
-		fmt.Printf("Invoke (confirm): cic_percent = %f\n",	project_record.CICPercent)
-		fmt.Printf("Invoke (confirm): bk_dept = %s\n",		project_record.BKDept)
-		fmt.Printf("Invoke (confirm): bk_team = %s\n",		project_record.BKTeam)
-		fmt.Printf("Invoke (confirm): bk_person = %s\n",	project_record.BKPerson)
-		fmt.Printf("Invoke (confirm): bk_amount = %f\n",	project_record.BKAmount)
-		fmt.Printf("Invoke (confirm): bk_confirmed = %t\n",	project_record.BKConfirmed)
-		fmt.Printf("Invoke (confirm): sc_dept = %s\n",		project_record.SCDept)
-		fmt.Printf("Invoke (confirm): sc_team = %s\n",		project_record.SCTeam)
-		fmt.Printf("Invoke (confirm): sc_person = %s\n",	project_record.SCPerson)
-		fmt.Printf("Invoke (confirm): sc_amount = %f\n",	project_record.SCAmount)
-		fmt.Printf("Invoke (confirm): sc_confirmed = %t\n",	project_record.SCConfirmed)
-		fmt.Printf("Invoke (confirm): tb_dept = %s\n",		project_record.TBDept)
-		fmt.Printf("Invoke (confirm): tb_team = %s\n",		project_record.TBTeam)
-		fmt.Printf("Invoke (confirm): tb_person = %s\n",	project_record.TBPerson)
-		fmt.Printf("Invoke (confirm): tb_amount = %f\n",	project_record.TBAmount)
-		fmt.Printf("Invoke (confirm): tb_confirmed = %t\n",	project_record.TBConfirmed)
+		fmt.Printf("Invoke (confirm): invest_amount = %s\n",	project_record.InvestAmount)
+		for _, participant := range project_record.Participants {
+			fmt.Printf("Invoke (confirm): %s: %s / %s / %s, amount = %s, confirmed = %t\n",
+				participant.Entity, participant.Dept, participant.Team, participant.Person, participant.Amount, participant.Confirmed)
+		}
 
 		entity := args[1]
-		if entity == "BK" {
-			project_record.BKConfirmed = true
-			fmt.Printf("Invoke (confirm): project_id: %s ($s) has been confirmed\n", project_id, entity)
-		} else if entity == "SC" {
-			project_record.SCConfirmed = true
-			fmt.Printf("Invoke (confirm): project_id: %s (%s) has been confirmed\n", project_id, entity)
-		} else if entity == "TB" {
-			project_record.TBConfirmed = true
-			fmt.Printf("Invoke (confirm): project_id: %s (%s) has been confirmed\n", project_id, entity)
-		} else {
-			return nil, errors.New("##### OpeEx1: Expecting entity name to be confirmed #####")
+		_, err = t.get_active_entity(stub, entity, ENTITY_ROLE_PARTICIPANT)
+		if err != nil {
+			return nil, err
 		}
-		if project_record.BKConfirmed == true && 
-		   project_record.SCConfirmed == true &&
-		   project_record.TBConfirmed == true {
-		   	project_record.Confirmed = true
-			fmt.Printf("Invoke (confirm): project_id: %s has been confirmed\n", project_id)
+		issuer, err := t.get_issuer(stub)
+		if err != nil {
+			return nil, err
 		}
-
-		fmt.Println("Calling Marshal in confirm")
-		bytes, err := json.Marshal(project_record)
+		participant, err := project_record.participant(entity)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error creating new Project record #####")
+			return nil, err
+		}
+		if participant.Confirmed {
+			fmt.Printf("Invoke (confirm): project_id: %s (%s) was already confirmed by %s in %s\n",
+				project_id, entity, participant.ConfirmedBy, participant.ConfirmedTx)
+			fmt.Println("Returning from Invoke: " + function)
+			return nil, nil
+		}
+		if project_record.Status == PROJECT_STATUS_RENEGOTIATION {
+			return nil, errors.New("##### OpeEx1: project_id: " + project_id + " is under renegotiation and has to be submitted again #####")
+		}
+		if project_record.Status == PROJECT_STATUS_DRAFT {
+			err = project_record.move_to(PROJECT_STATUS_SUBMITTED)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("Invoke (confirm): project_id: %s has been submitted\n", project_id)
+		}
+		participant.Confirmed = true
+		participant.ConfirmedBy = user
+		participant.ConfirmedAt = format_time(now)
+		participant.ConfirmedTx = tx_id
+		fmt.Printf("Invoke (confirm): project_id: %s (%s) has been confirmed\n", project_id, entity)
+		if project_record.all_confirmed() {
+			err = project_record.move_to(PROJECT_STATUS_CONFIRMED)
+			fmt.Printf("Invoke (confirm): project_id: %s has been confirmed\n", project_id)
+		} else {
+			err = project_record.move_to(PROJECT_STATUS_PARTIALLY_CONFIRMED)
 		}
-		fmt.Println("Calling PutState in confirm")
-		err = stub.PutState(project_key, []byte(bytes))
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state for Project #####")
+			return nil, err
 		}
 
-		// Get current amount for the entity
-		amount_asbytes, err := stub.GetState(entity)
+		fmt.Println("Calling save_project in confirm")
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for " + entity + " #####")
+			return nil, err
 		}
-		var amount_record Amount
-		err = json.Unmarshal(amount_asbytes, &amount_record)
+
+		// Move the allocated amount from the issuer to the entity
+		err = t.post(stub, function, project_id, entity, issuer, participant.Amount, now, tx_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(amount_asbytes) + " #####")
+			return nil, err
 		}
-		fmt.Printf("Invoke (confirm): current_amount for %s = %f\n", entity, amount_record.Amount)
 
-		// Add new amount to current_amount
-		if entity == "BK" {
-			amount_record.Amount = amount_record.Amount + project_record.BKAmount
-		} else if entity == "SC" {
-			amount_record.Amount = amount_record.Amount + project_record.SCAmount
-		} else if entity == "TB" {
-			amount_record.Amount = amount_record.Amount + project_record.TBAmount
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "submit" || function == "close" || function == "cancel" || function == "reopen" {
+		// (ProjectId)
+		// submit: draft -> submitted, renegotiation -> by the confirmations which remain,
+		// close: confirmed -> closed, cancel: draft | submitted | renegotiation -> cancelled,
+		// reopen: closed -> confirmed | cancelled -> draft
+		fmt.Println("Entering into " + function)
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for " + function + " #####")
 		}
-		fmt.Printf("Invoke (confirm): new_amount for %s = %f\n", entity, amount_record.Amount)
 
-		// update amount_record
-		bytes, err = json.Marshal(amount_record)
+		project_record, err := t.load_project(stub, args[0])
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
+			return nil, err
 		}
-		err = stub.PutState(entity, []byte(bytes))
-		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+		var status string
+		if function == "submit" && project_record.Status == PROJECT_STATUS_RENEGOTIATION {
+			status = project_record.confirmation_status()
+			for i := range project_record.Participants {
+				project_record.Participants[i].Rejected = false
+			}
+		} else if function == "submit" {
+			status = PROJECT_STATUS_SUBMITTED
+		} else if function == "close" {
+			status = PROJECT_STATUS_CLOSED
+		} else if function == "cancel" {
+			if project_record.has_confirmations() {
+				return nil, errors.New("##### OpeEx1: project_id: " + project_record.ProjectId + " has confirmations, unconfirm them before cancel #####")
+			}
+			status = PROJECT_STATUS_CANCELLED
+		} else if project_record.Status == PROJECT_STATUS_CLOSED {
+			status = PROJECT_STATUS_CONFIRMED
+		} else {
+			status = PROJECT_STATUS_DRAFT
 		}
-
-		// Get current amount for "FG"
-		amount_asbytes, err = stub.GetState("FG")
+		err = project_record.move_to(status)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Failed to get state for FG #####")
+			return nil, err
 		}
-		err = json.Unmarshal(amount_asbytes, &amount_record)
+		fmt.Printf("Invoke (%s): project_id: %s is now %s\n", function, project_record.ProjectId, project_record.Status)
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error unmarshalling data for FG " + string(amount_asbytes) + " #####")
+			return nil, err
 		}
-		fmt.Printf("Invoke (confirm): current_amount for FG = %f\n", amount_record.Amount)
 
-		// Substruct amount from current_amount
-		if entity == "BK" {
-			amount_record.Amount = amount_record.Amount - project_record.BKAmount
-		} else if entity == "SC" {
-			amount_record.Amount = amount_record.Amount - project_record.SCAmount
-		} else if entity == "TB" {
-			amount_record.Amount = amount_record.Amount - project_record.TBAmount
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "reject" || function == "unconfirm" {
+		// (ProjectId, Entity, Reason)
+		// reject: refuses an allocation not yet confirmed,
+		// unconfirm: withdraws a confirmation and moves the amount back to the issuer
+		// Both put the project under renegotiation
+		fmt.Println("Entering into " + function)
+		if len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 3 arguments for " + function + " #####")
+		}
+		if strings.TrimSpace(args[2]) == "" {
+			return nil, errors.New("##### OpeEx1: Expecting a reason for " + function + " #####")
 		}
-		fmt.Printf("Invoke (confirm): new_amount for FG = %f\n", entity, amount_record.Amount)
 
-		// update amount_record
-		bytes, err = json.Marshal(amount_record)
+		project_record, err := t.load_project(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		entity := args[1]
+		participant, err := project_record.participant(entity)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error creating new Amount record #####")
+			return nil, err
 		}
-		err = stub.PutState("FG", []byte(bytes))
+		err = project_record.move_to(PROJECT_STATUS_RENEGOTIATION)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Unable to put the state #####")
+			return nil, err
+		}
+		if function == "reject" {
+			if participant.Confirmed {
+				return nil, errors.New("##### OpeEx1: project_id: " + project_record.ProjectId + " has been confirmed by " + entity + ", use unconfirm #####")
+			}
+			participant.Rejected = true
+		} else {
+			if !participant.Confirmed {
+				return nil, errors.New("##### OpeEx1: project_id: " + project_record.ProjectId + " has not been confirmed by " + entity + " #####")
+			}
+			issuer, err := t.get_issuer(stub)
+			if err != nil {
+				return nil, err
+			}
+			err = t.post(stub, function, project_record.ProjectId, issuer, entity, participant.Amount, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
+			participant.Confirmed = false
+			participant.ConfirmedBy, participant.ConfirmedAt, participant.ConfirmedTx = "", "", ""
+		}
+		participant.Reason = args[2]
+		fmt.Printf("Invoke (%s): project_id: %s (%s): %s\n", function, project_record.ProjectId, entity, participant.Reason)
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
+		if err != nil {
+			return nil, err
 		}
 
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
 	} else if function == "ranking" {		// ranking //
-		// (Year, Person, Rank, URL)
+		// (Year, Person, Rank, URL), empty Year for the current fiscal year
 		fmt.Println("Entering into ranking")
 		if len(args) != 4 {
 			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 4 arguments for ranking #####")
 		}
 
 		var ranking_record Ranking
-		ranking_record.Year, err = strconv.ParseUint(args[0], 10, 16)
+		year, err := t.parse_fiscal_year(stub, args[0], now)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Expecting uint value for Year #####")
+			return nil, err
 		}
+		ranking_record.Year = uint64(year)
 		ranking_record.Person =	args[1]
 		ranking_record.URL =	args[3]
 		ranking_record.Rank, err = strconv.ParseUint(args[2], 10, 16)
@@ -889,7 +1508,12 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		fmt.Printf("Invoke (ranking): Person = %s\n",	ranking_record.Person)
 		fmt.Printf("Invoke (ranking): URL = %s\n",	ranking_record.URL)
 
-		// update amount_record
+		// update ranking_record
+		ranking_record.Stamp, err = t.get_stamp(stub, ranking_key)
+		if err != nil {
+			return nil, err
+		}
+		ranking_record.touch(now, tx_id)
 		bytes, err := json.Marshal(ranking_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error creating new Ranking record #####")
@@ -901,385 +1525,5162 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		
 		fmt.Println("Returning from Invoke: " + function)
 		return nil, nil
-	}
+	} else if function == "reverse_issue" {		// reverse_issue //
+		// (ProjectId, Tranche, Amount, Reason), Amount in the currency of the tranche
+		fmt.Println("Entering into reverse_issue")
+		if len(args) != 4 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 4 arguments for reverse_issue #####")
+		}
+		if args[2] == "" {
+			return nil, errors.New("##### OpeEx1: Expecting amount to be reversed, use cancel_issue to reverse a whole tranche #####")
+		}
+		err = t.reverse_issue(stub, function, args[0], args[1], args[2], args[3], now, tx_id)
+		if err != nil {
+			return nil, err
+		}
 
-	// Error
-	fmt.Println("Invoke did not find function: " + function)
-	return nil, errors.New("##### OpeEx1: Received unknown function for Invoke #####")
-}
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "cancel_issue" {		// cancel_issue //
+		// (ProjectId, Tranche, Reason), reverses whatever remains of the tranche
+		fmt.Println("Entering into cancel_issue")
+		if len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 3 arguments for cancel_issue #####")
+		}
+		err = t.reverse_issue(stub, function, args[0], args[1], "", args[2], now, tx_id)
+		if err != nil {
+			return nil, err
+		}
 
-//
-// Query callback representing the query of a chaincode
-//
-func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
-	fmt.Println("Entering into Query: " + function)
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "transfer" {		// transfer //
+		// (From, To, Amount, Reason [, ProjectId [, RequestId]]), by a member of From
+		// A RequestId seen before is a no-op
+		fmt.Println("Entering into transfer")
+		if len(args) < 4 || len(args) > 6 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 4 to 6 arguments for transfer #####")
+		}
+		if len(args) == 6 && args[5] != "" {
+			processed, err := t.check_request(stub, args[5], function, args[:5])
+			if err != nil {
+				return nil, err
+			}
+			if processed {
+				fmt.Println("Returning from Invoke: " + function)
+				return nil, nil
+			}
+			err = t.put_request(stub, args[5], function, args[:5], user, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	if function == "get_current_amount" {
-		if len(args) != 1 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		from_record, err := t.get_active_entity(stub, args[0], "")
+		if err != nil {
+			return nil, err
+		}
+		to_record, err := t.get_active_entity(stub, args[1], "")
+		if err != nil {
+			return nil, err
+		}
+		if from_record.Code == to_record.Code {
+			return nil, errors.New("##### OpeEx1: Expecting different entities to transfer between #####")
+		}
+		if !from_record.has_member(user) {
+			return nil, errors.New("##### OpeEx1: " + user + " is not authorized by entity: " + from_record.Code + " #####")
+		}
+		transfer_record := Transfer {
+			TxId:		tx_id,
+			From:		from_record.Code,
+			To:		to_record.Code,
+			Reason:		args[3],
+			TransferredBy:	user,
+		}
+		transfer_record.Amount, err = parse_money(args[2])
+		if err != nil || transfer_record.Amount <= 0 {
+			return nil, errors.New("##### OpeEx1: Expecting positive decimal value for Amount #####")
+		}
+		if transfer_record.Reason == "" {
+			return nil, errors.New("##### OpeEx1: Expecting reason for transfer #####")
+		}
+		if len(args) >= 5 && args[4] != "" {
+			project_record, err := t.load_project(stub, args[4])
+			if err != nil {
+				return nil, err
+			}
+			transfer_record.ProjectId = project_record.ProjectId
 		}
 
-		entity := args[0]
-		fmt.Println("Executing Query: " + function)
-		return t.get_current_amount(stub, entity)
-	} else if function == "get_project" {
-		if len(args) != 1 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		err = t.post(stub, function, transfer_record.ProjectId, transfer_record.To, transfer_record.From, transfer_record.Amount, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+		transfer_record.Sequence, err = t.get_journal_sequence(stub)
+		if err != nil {
+			return nil, err
 		}
+		transfer_record.touch(now, tx_id)
+		bytes, err := json.Marshal(transfer_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new Transfer record #####")
+		}
+		err = stub.PutState(fmt.Sprintf("transfer/%012d", transfer_record.Sequence), []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for Transfer #####")
+		}
+		fmt.Printf("Invoke (transfer): %s moved from %s to %s\n", transfer_record.Amount, transfer_record.From, transfer_record.To)
 
-		project_id := args[0]
-		fmt.Println("Executing Query: " + function)
-		return t.get_project(stub, project_id)
-	} else if function == "get_issue" {
-		if len(args) != 1 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "register_entity" {		// register_entity //
+		// (Code, Name, Role)
+		fmt.Println("Entering into register_entity")
+		if len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 3 arguments for register_entity #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
 		}
 
-		project_id := args[0]
-		fmt.Println("Executing Query: " + function)
-		return t.get_issue(stub, project_id)
-	} else if function == "get_distribution" {
-		if len(args) != 1 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		entity_record := Entity {
+			Code:		strings.ToUpper(strings.TrimSpace(args[0])),
+			Name:		args[1],
+			Role:		args[2],
+			Active:		true,
+		}
+		err = check_entity_code(entity_record.Code)
+		if err != nil {
+			return nil, err
+		}
+		if entity_record.Role != ENTITY_ROLE_ISSUER && entity_record.Role != ENTITY_ROLE_PARTICIPANT {
+			return nil, errors.New("##### OpeEx1: Expecting \"" + ENTITY_ROLE_ISSUER + "\" or \"" + ENTITY_ROLE_PARTICIPANT + "\" for Role #####")
+		}
+		_, err = t.get_entity(stub, entity_record.Code)
+		if err == nil {
+			return nil, errors.New("##### OpeEx1: entity: " + entity_record.Code + " has already been registered #####")
+		}
+		if entity_record.Role == ENTITY_ROLE_ISSUER {
+			issuer, err := t.get_issuer(stub)
+			if err == nil {
+				return nil, errors.New("##### OpeEx1: " + issuer + " is already the active issuer #####")
+			}
+		}
+		err = t.put_entity(stub, entity_record, now, tx_id)
+		if err != nil {
+			return nil, err
 		}
 
-		project_id := args[0]
-		fmt.Println("Executing Query: " + function)
-		return t.get_distribution(stub, project_id)
-	} else if function == "get_receivable" {
+		// Balance starts from 0 unless one is left from an earlier registration
+		amount_asbytes, err := stub.GetState(entity_record.Code)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Failed to get state for " + entity_record.Code + " #####")
+		}
+		if amount_asbytes == nil {
+			err = t.put_amount(stub, Amount{Entity: entity_record.Code}, now, tx_id)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "rename_entity" {		// rename_entity //
+		// (Code, Name)
+		fmt.Println("Entering into rename_entity")
+		if len(args) != 2 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for rename_entity #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		entity_record, err := t.get_entity(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		entity_record.Name = args[1]
+		err = t.put_entity(stub, entity_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "deactivate_entity" {		// deactivate_entity //
+		// (Code)
+		fmt.Println("Entering into deactivate_entity")
 		if len(args) != 1 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for deactivate_entity #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
 		}
 
-		project_id := args[0]
-		fmt.Println("Executing Query: " + function)
-		return t.get_receivable(stub, project_id)
-	} else if function == "get_ranking" {
+		entity_record, err := t.get_entity(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		entity_record.Active = false
+		err = t.put_entity(stub, entity_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "add_entity_member" || function == "remove_entity_member" {		// add_entity_member / remove_entity_member //
+		// (Code, User)
+		fmt.Println("Entering into " + function)
 		if len(args) != 2 {
-			fmt.Printf("Incorrect number of arguments passed");
-			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for " + function + " #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		if args[1] == "" {
+			return nil, errors.New("##### OpeEx1: Expecting user for " + function + " #####")
 		}
 
-		ranking_year, err := strconv.ParseUint(args[0], 10, 16)
+		entity_record, err := t.get_entity(stub, args[0])
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Expecting uint value for Year #####")
+			return nil, err
+		}
+		members := []string{}
+		for _, member := range entity_record.Members {
+			if member != args[1] {
+				members = append(members, member)
+			}
+		}
+		if function == "add_entity_member" {
+			members = append(members, args[1])
+		}
+		entity_record.Members = members
+		err = t.put_entity(stub, entity_record, now, tx_id)
+		if err != nil {
+			return nil, err
 		}
-		ranking_person := args[1]
 
-		fmt.Println("Executing Query: " + function)
-		return t.get_ranking(stub, ranking_year, ranking_person)
-	} else if function == "get_all_project" {
-		fmt.Println("Executing Query: " + function)
-		return t.get_all_project(stub)
-	} else if function == "get_all_issue" {
-		fmt.Println("Executing Query: " + function)
-		return t.get_all_issue(stub)
-	} else if function == "get_all_distribution" {
-		fmt.Println("Executing Query: " + function)
-		return t.get_all_distribution(stub)
-	} else if function == "get_all_receivable" {
-		fmt.Println("Executing Query: " + function)
-		return t.get_all_receivable(stub)
-	}	
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "patch_project" {		// patch_project //
+		// (ProjectId, Field, Value, [Field, Value, ...])
+		// Field: project_name | invest_type | invest_amount |
+		//  participant.{Entity}.dept | participant.{Entity}.team | participant.{Entity}.person |
+		//  participant.{Entity}.amount | beneficiary.{Code}.percent
+		// Only the fields of PROJECT_EDITABLE for the status of the project may change
+		fmt.Println("Entering into patch_project")
+		if len(args) < 3 || len(args) % 2 != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 + 2 x fields arguments for patch_project #####")
+		}
 
-	// Error
-	fmt.Println("Query did not find function: " + function)
-	return nil, errors.New("##### OpeEx1: Received unknown function for Query #####")
+		project_record, err := t.load_project(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		v, err := t.get_validator(stub)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(args); i += 2 {
+			project_record.patch(v, args[i], args[i + 1])
+		}
+		config, err := t.get_consistency_config(stub)
+		if err != nil {
+			return nil, err
+		}
+		project_record.check_consistency(v, config.Rules, config.Tolerance, config.PercentTolerance)
+		err = v.error()
+		if err != nil {
+			return nil, err
+		}
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_project_beneficiaries" {		// set_project_beneficiaries //
+		// (ProjectId, Code, Percent, [Code, Percent, ...])
+		// Only while PROJECT_EDITABLE allows beneficiary.percent for the status of the project
+		fmt.Println("Entering into set_project_beneficiaries")
+		if len(args) < 3 || len(args) % 2 != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 + 2 x beneficiaries arguments for set_project_beneficiaries #####")
+		}
+
+		project_record, err := t.load_project(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		var beneficiary_args []BeneficiaryArgs
+		for i := 1; i < len(args); i += 2 {
+			beneficiary_args = append(beneficiary_args, BeneficiaryArgs{Code: args[i], Percent: args[i + 1]})
+		}
+		v, err := t.get_validator(stub)
+		if err != nil {
+			return nil, err
+		}
+		if !project_record.editable("beneficiary.percent") {
+			return nil, errors.New("##### OpeEx1: Beneficiaries of project_id: " + project_record.ProjectId + " may not change while the project is " + project_record.Status + " #####")
+		}
+		project_record.Beneficiaries = t.make_beneficiary_shares(stub, v, beneficiary_args, false)
+		config, err := t.get_consistency_config(stub)
+		if err != nil {
+			return nil, err
+		}
+		project_record.check_consistency(v, config.Rules, config.Tolerance, config.PercentTolerance)
+		err = v.error()
+		if err != nil {
+			return nil, err
+		}
+		err = t.save_project(stub, project_record, function, user, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "register_beneficiary" {		// register_beneficiary //
+		// (Code, Name)
+		fmt.Println("Entering into register_beneficiary")
+		if len(args) != 2 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for register_beneficiary #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		beneficiary_record := Beneficiary {
+			Code:		strings.ToUpper(strings.TrimSpace(args[0])),
+			Name:		args[1],
+			Active:		true,
+		}
+		if beneficiary_record.Code == "" || strings.ContainsAny(beneficiary_record.Code, "/~") {
+			return nil, errors.New("##### OpeEx1: Expecting beneficiary code without \"/\" or \"~\" #####")
+		}
+		_, err = t.get_beneficiary(stub, beneficiary_record.Code)
+		if err == nil {
+			return nil, errors.New("##### OpeEx1: beneficiary: " + beneficiary_record.Code + " has already been registered #####")
+		}
+		err = t.put_beneficiary(stub, beneficiary_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "rename_beneficiary" {		// rename_beneficiary //
+		// (Code, Name)
+		fmt.Println("Entering into rename_beneficiary")
+		if len(args) != 2 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for rename_beneficiary #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		beneficiary_record, err := t.get_beneficiary(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		beneficiary_record.Name = args[1]
+		err = t.put_beneficiary(stub, beneficiary_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "retire_beneficiary" {		// retire_beneficiary //
+		// (Code)
+		fmt.Println("Entering into retire_beneficiary")
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for retire_beneficiary #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		beneficiary_record, err := t.get_beneficiary(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		beneficiary_record.Active = false
+		err = t.put_beneficiary(stub, beneficiary_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "open_journal" {		// open_journal //
+		// ()
+		// Journals the balances which existed before the journal against ACCOUNT_OPENING,
+		// so that every balance can be checked; balances already journaled are left out
+		fmt.Println("Entering into open_journal")
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		checks, err := t.check_journal(stub)
+		if err != nil {
+			return nil, err
+		}
+		for _, check := range checks {
+			if check.Difference == 0 {
+				continue
+			}
+			debit, credit, amount := check.Entity, ACCOUNT_OPENING, check.Difference
+			if amount < 0 {
+				debit, credit, amount = credit, debit, -amount
+			}
+			entry := JournalEntry {
+				TxId:		tx_id,
+				Function:	function,
+				Lines:		[]JournalLine {
+					{ Account: debit, Debit: amount },
+					{ Account: credit, Credit: amount },
+				},
+			}
+			err = t.write_journal(stub, &entry, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "close_fiscal_year" {		// close_fiscal_year //
+		// (FiscalYear)
+		// Snapshots the balance of every entity at the end of the year and locks
+		// the year; only a year which has ended can be closed, the first one no
+		// earlier than the first journal entry, and after it years are closed in
+		// order, each opening with the closing of the last
+		fmt.Println("Entering into close_fiscal_year")
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for close_fiscal_year #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		year, err := t.parse_fiscal_year(stub, args[0], now)
+		if err != nil {
+			return nil, err
+		}
+		year_str := strconv.FormatUint(uint64(year), 10)
+		calendar, err := t.get_fiscal_calendar(stub)
+		if err != nil {
+			return nil, err
+		}
+		if year >= calendar.fiscal_year(now) {
+			return nil, errors.New("##### OpeEx1: FY" + year_str + " has not ended #####")
+		}
+		last, err := t.get_last_closed_year(stub)
+		if err != nil {
+			return nil, err
+		}
+		if last == 0 {
+			sequence, err := t.get_journal_sequence(stub)
+			if err != nil {
+				return nil, err
+			}
+			if sequence == 0 {
+				return nil, errors.New("##### OpeEx1: Nothing has been posted to the journal, there is no year to close #####")
+			}
+			first_entry, err := t.get_journal_entry(stub, 1)
+			if err != nil {
+				return nil, err
+			}
+			timestamp, err := time.Parse(time.RFC3339, first_entry.CreatedAt)
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Error parsing timestamp of journal entry 1 #####")
+			}
+			first_year := calendar.fiscal_year(timestamp)
+			if year < first_year {
+				return nil, errors.New("##### OpeEx1: FY" + year_str + " is before the first journal entry in FY" + strconv.FormatUint(uint64(first_year), 10) + " #####")
+			}
+		}
+		if last != 0 && year <= last {
+			return nil, errors.New("##### OpeEx1: FY" + year_str + " has already been closed #####")
+		}
+		if last != 0 && year != last + 1 {
+			return nil, errors.New("##### OpeEx1: FY" + strconv.FormatUint(uint64(last + 1), 10) + " must be closed before FY" + year_str + " #####")
+		}
+
+		start, end := calendar.year_range(year)
+		close_record := FiscalClose {
+			Year:		year,
+			YearStart:	format_time(start),
+			YearEnd:	format_time(end),
+			ClosedBy:	user,
+			Entities:	[]string{},
+		}
+		entities, err := t.get_all_entities(stub)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity_record := range entities {
+			snapshot, err := t.get_balance_snapshot(stub, entity_record.Code, year)
+			if err != nil {
+				return nil, err
+			}
+			snapshot.Closed = true
+			snapshot.touch(now, tx_id)
+			bytes, err := json.Marshal(snapshot)
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Error creating new BalanceSnapshot record #####")
+			}
+			err = stub.PutState("snapshot/" + year_str + "/" + entity_record.Code, []byte(bytes))
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Unable to put the state for BalanceSnapshot #####")
+			}
+			fmt.Printf("Invoke (close_fiscal_year): %s: %s -> %s\n", snapshot.Entity, snapshot.Opening, snapshot.Closing)
+			close_record.Entities = append(close_record.Entities, entity_record.Code)
+		}
+
+		close_record.touch(now, tx_id)
+		bytes, err := json.Marshal(close_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new FiscalClose record #####")
+		}
+		err = stub.PutState("period/" + year_str, []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for FiscalClose #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_reservation_policy" {		// set_reservation_policy //
+		// (Enabled), "true" to reserve funds when a project is registered
+		fmt.Println("Entering into set_reservation_policy")
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for set_reservation_policy #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		var config ReservationConfig
+		config.Enabled, err = strconv.ParseBool(args[0])
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Expecting bool value for Enabled #####")
+		}
+		bytes, err := json.Marshal(config)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new ReservationConfig record #####")
+		}
+		err = stub.PutState("config/reservation", []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for ReservationConfig #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_validation_mode" {		// set_validation_mode //
+		// (Mode), VALIDATION_LENIENT | VALIDATION_STRICT
+		fmt.Println("Entering into set_validation_mode")
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for set_validation_mode #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		if args[0] != VALIDATION_LENIENT && args[0] != VALIDATION_STRICT {
+			return nil, errors.New("##### OpeEx1: Expecting \"" + VALIDATION_LENIENT + "\" or \"" + VALIDATION_STRICT + "\" for Mode #####")
+		}
+
+		bytes, err := json.Marshal(ValidationConfig{Mode: args[0]})
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new ValidationConfig record #####")
+		}
+		err = stub.PutState("config/validation", []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for ValidationConfig #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_rounding_mode" {		// set_rounding_mode //
+		// (Rounding), ROUND_HALF_UP | ROUND_HALF_EVEN | ROUND_DOWN
+		fmt.Println("Entering into set_rounding_mode")
+		if len(args) != 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 argument for set_rounding_mode #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		known := false
+		for _, mode := range ROUNDING_MODES {
+			known = known || args[0] == mode
+		}
+		if !known {
+			return nil, errors.New("##### OpeEx1: Expecting one of " + strings.Join(ROUNDING_MODES, ", ") + " for Rounding #####")
+		}
+
+		bytes, err := json.Marshal(MoneyConfig{Rounding: args[0]})
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new MoneyConfig record #####")
+		}
+		err = stub.PutState("config/money", []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for MoneyConfig #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "migrate_money" {		// migrate_money //
+		// (), rewrites the numbers of records written before Money as decimal strings
+		fmt.Println("Entering into migrate_money")
+		if len(args) != 0 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 0 arguments for migrate_money #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := t.migrate_money(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Invoke (migrate_money): %d of %d records rewritten\n", migration.Rewritten, migration.Keys)
+
+		fmt.Println("Returning from Invoke: " + function)
+		return json.Marshal(migration)
+	} else if function == "set_consistency_rules" {		// set_consistency_rules //
+		// (Tolerance [, PercentTolerance] [, Rule, ...]), no Rule to enforce none;
+		// PercentTolerance is taken as such when it is a number, empty for the default
+		fmt.Println("Entering into set_consistency_rules")
+		if len(args) < 1 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 1 + rules arguments for set_consistency_rules #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+
+		var config ConsistencyConfig
+		config.Tolerance, err = parse_money(args[0])
+		if err != nil || config.Tolerance < 0 {
+			return nil, errors.New("##### OpeEx1: Expecting non-negative decimal value for Tolerance #####")
+		}
+		config.PercentTolerance = DEFAULT_PERCENT_TOLERANCE
+		rules := args[1:]
+		if len(rules) > 0 && (rules[0] == "" || is_number(rules[0])) {
+			if rules[0] != "" {
+				config.PercentTolerance, err = parse_ratio(rules[0])
+				if err != nil || config.PercentTolerance < 0 {
+					return nil, errors.New("##### OpeEx1: Expecting non-negative decimal value for PercentTolerance #####")
+				}
+			}
+			rules = rules[1:]
+		}
+		config.Rules = []string{}
+		for _, rule := range rules {
+			known := false
+			for _, known_rule := range CONSISTENCY_RULES {
+				known = known || rule == known_rule
+			}
+			if !known {
+				return nil, errors.New("##### OpeEx1: Unknown consistency rule: " + rule + " #####")
+			}
+			config.Rules = append(config.Rules, rule)
+		}
+		bytes, err := json.Marshal(config)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new ConsistencyConfig record #####")
+		}
+		err = stub.PutState("config/consistency", []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for ConsistencyConfig #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_rate" {		// set_rate //
+		// (Currency, Rate)
+		fmt.Println("Entering into set_rate")
+		if len(args) != 2 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for set_rate #####")
+		}
+		err = t.check_role(stub, user, ROLE_RATE)
+		if err != nil {
+			return nil, err
+		}
+
+		var rate_record Rate
+		rate_record.Currency, err = t.normalize_currency(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if rate_record.Currency == REPORTING_CURRENCY {
+			return nil, errors.New("##### OpeEx1: Rate for reporting currency " + REPORTING_CURRENCY + " is fixed at 1 #####")
+		}
+		rate_record.Rate, err = parse_ratio(args[1])
+		if err != nil || rate_record.Rate <= 0 {
+			return nil, errors.New("##### OpeEx1: Expecting positive decimal value for Rate #####")
+		}
+		rate_record.UpdatedBy = user
+		rate_record.Stamp, err = t.get_stamp(stub, "rate/" + rate_record.Currency)
+		if err != nil {
+			return nil, err
+		}
+		rate_record.touch(now, tx_id)
+		fmt.Printf("Invoke (set_rate): 1 %s = %s %s\n", rate_record.Currency, rate_record.Rate, REPORTING_CURRENCY)
+
+		bytes, err := json.Marshal(rate_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new Rate record #####")
+		}
+		err = stub.PutState("rate/" + rate_record.Currency, []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for Rate #####")
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_budget" {		// set_budget //
+		// (Entity, FiscalYear, Cap)
+		fmt.Println("Entering into set_budget")
+		if len(args) != 3 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 3 arguments for set_budget #####")
+		}
+		err = t.check_role(stub, user, ROLE_BUDGET)
+		if err != nil {
+			return nil, err
+		}
+
+		var budget_record Budget
+		entity_record, err := t.get_entity(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		budget_record.Entity = entity_record.Code
+		budget_record.Year, err = t.parse_fiscal_year(stub, args[1], now)
+		if err != nil {
+			return nil, err
+		}
+		year_str := strconv.FormatUint(uint64(budget_record.Year), 10)
+		last, err := t.get_last_closed_year(stub)
+		if err != nil {
+			return nil, err
+		}
+		if budget_record.Year <= last {
+			return nil, errors.New("##### OpeEx1: FY" + year_str + " has been closed #####")
+		}
+		budget_record.Cap, err = parse_money(args[2])
+		if err != nil || budget_record.Cap < 0 {
+			return nil, errors.New("##### OpeEx1: Expecting non-negative decimal value for Cap #####")
+		}
+		budget_record.SetBy = user
+		budget_record.Used, err = t.count_budget_used(stub, budget_record.Entity, budget_record.Year)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Invoke (set_budget): %s: FY%s cap = %s, used = %s\n", budget_record.Entity, year_str, budget_record.Cap, budget_record.Used)
+		err = t.put_budget(stub, budget_record, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "set_fiscal_calendar" {		// set_fiscal_calendar //
+		// (StartMonth, YearLabel, TimeZone, UTCOffset [, Q1Month, Q2Month, Q3Month, Q4Month])
+		// Refused once a fiscal year has been closed, whose snapshot would no longer match its year
+		fmt.Println("Entering into set_fiscal_calendar")
+		if len(args) != 4 && len(args) != 8 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 4 or 8 arguments for set_fiscal_calendar #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		last, err := t.get_last_closed_year(stub)
+		if err != nil {
+			return nil, err
+		}
+		if last != 0 {
+			return nil, errors.New(fmt.Sprintf("##### OpeEx1: FY%d has been closed, the fiscal calendar may no longer change #####", last))
+		}
+
+		var calendar FiscalCalendar
+		start_month, err := strconv.ParseUint(args[0], 10, 8)
+		if err != nil || start_month < 1 || start_month > 12 {
+			return nil, errors.New("##### OpeEx1: Expecting 1-12 for StartMonth #####")
+		}
+		calendar.StartMonth = uint8(start_month)
+		calendar.YearLabel = args[1]
+		if calendar.YearLabel != FY_LABEL_START && calendar.YearLabel != FY_LABEL_END {
+			return nil, errors.New("##### OpeEx1: Expecting \"" + FY_LABEL_START + "\" or \"" + FY_LABEL_END + "\" for YearLabel #####")
+		}
+		calendar.TimeZone = args[2]
+		calendar.UTCOffset, err = strconv.Atoi(args[3])
+		if err != nil || calendar.UTCOffset < -12 * 3600 || calendar.UTCOffset > 14 * 3600 {
+			return nil, errors.New("##### OpeEx1: Expecting seconds east of UTC for UTCOffset #####")
+		}
+		if len(args) == 8 {
+			for i := 4; i < 8; i++ {
+				month, err := strconv.ParseUint(args[i], 10, 8)
+				if err != nil || month < 1 || month > 12 {
+					return nil, errors.New("##### OpeEx1: Expecting 1-12 for quarter start months #####")
+				}
+				calendar.Quarters = append(calendar.Quarters, uint8(month))
+			}
+		} else {
+			for i := 0; i < 4; i++ {
+				calendar.Quarters = append(calendar.Quarters, uint8((int(calendar.StartMonth) - 1 + 3 * i) % 12 + 1))
+			}
+		}
+		err = calendar.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		bytes, err := json.Marshal(calendar)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error creating new FiscalCalendar record #####")
+		}
+		err = stub.PutState("config/fiscal_calendar", []byte(bytes))
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Unable to put the state for FiscalCalendar #####")
+		}
+		err = t.recount_budgets(stub, now, tx_id)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	} else if function == "grant_role" {		// grant_role //
+		// (User, Role)
+		fmt.Println("Entering into grant_role")
+		if len(args) != 2 {
+			return nil, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 2 arguments for grant_role #####")
+		}
+		err = t.check_role(stub, user, ROLE_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+		err = t.grant_role(stub, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Println("Returning from Invoke: " + function)
+		return nil, nil
+	}
+
+	// Error
+	fmt.Println("Invoke did not find function: " + function)
+	return nil, errors.New("##### OpeEx1: Received unknown function for Invoke #####")
+}
+
+//
+// query
+//
+func (t *SimpleChaincode) query(stub LedgerStub, function string, args []string) ([]byte, error) {
+	fmt.Println("Entering into Query: " + function)
+
+	// Queries write nothing, so the peer clock is used to default the fiscal year
+
+	// Every function also takes one JSON object with the fields of QUERY_ARGS
+	args, err := t.named_args(function, args, QUERY_ARGS)
+	if err != nil {
+		return nil, err
+	}
+
+	if function == "get_current_amount" {
+		// (Entity [, FiscalYear]), with FiscalYear the balance over that year
+		if len(args) != 1 && len(args) != 2 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		entity := args[0]
+		_, err := t.get_entity(stub, entity)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 2 && args[1] != "" {
+			year, err := t.parse_fiscal_year(stub, args[1], time.Now())
+			if err != nil {
+				return nil, err
+			}
+			snapshot, err := t.get_balance_snapshot(stub, entity, year)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Println("Executing Query: " + function)
+			return json.Marshal(snapshot)
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_current_amount(stub, entity)
+	} else if function == "get_project" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		project_id := args[0]
+		fmt.Println("Executing Query: " + function)
+		return t.get_project(stub, project_id)
+	} else if function == "get_project_history" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		fmt.Println("Executing Query: " + function)
+		return t.get_project_history(stub, args[0])
+	} else if function == "get_project_at_version" {
+		if len(args) != 2 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Expecting uint value for Version #####")
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_project_at_version(stub, args[0], uint32(version))
+	} else if function == "get_amendments" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		amendments, err := t.get_amendments(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(amendments)
+	} else if function == "get_all_transfer" {
+		// ([Entity]), transfers from or to Entity, every transfer without
+		if len(args) > 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+		entity := ""
+		if len(args) == 1 {
+			entity = args[0]
+		}
+		transfers, err := t.get_all_transfer(stub, entity)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(transfers)
+	} else if function == "get_issue" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		project_id := args[0]
+		fmt.Println("Executing Query: " + function)
+		return t.get_issue(stub, project_id)
+	} else if function == "get_distribution" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		project_id := args[0]
+		fmt.Println("Executing Query: " + function)
+		return t.get_distribution(stub, project_id)
+	} else if function == "get_receivable" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		project_id := args[0]
+		fmt.Println("Executing Query: " + function)
+		return t.get_receivable(stub, project_id)
+	} else if function == "get_ranking" {
+		if len(args) != 2 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		ranking_year, err := t.parse_fiscal_year(stub, args[0], time.Now())
+		if err != nil {
+			return nil, err
+		}
+		ranking_person := args[1]
+
+		fmt.Println("Executing Query: " + function)
+		return t.get_ranking(stub, uint64(ranking_year), ranking_person)
+	} else if function == "get_all_project" {
+		// ([Status])
+		var status string
+		if len(args) > 0 && args[0] != "" {
+			status = args[0]
+			_, ok := PROJECT_TRANSITIONS[status]
+			if !ok {
+				return nil, errors.New("##### OpeEx1: Unknown project status: " + status + " #####")
+			}
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_project(stub, status)
+	} else if function == "get_all_issue" {
+		// ([FiscalYear])
+		var issue_year uint16
+		if len(args) > 0 && args[0] != "" {
+			year, err := t.parse_fiscal_year(stub, args[0], time.Now())
+			if err != nil {
+				return nil, err
+			}
+			issue_year = year
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_issue(stub, issue_year)
+	} else if function == "get_all_distribution" {
+		// ([FiscalYear])
+		var issue_year uint16
+		if len(args) > 0 && args[0] != "" {
+			year, err := t.parse_fiscal_year(stub, args[0], time.Now())
+			if err != nil {
+				return nil, err
+			}
+			issue_year = year
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_distribution(stub, issue_year)
+	} else if function == "get_all_receivable" {
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_receivable(stub)
+	} else if function == "get_rate" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		currency, rate, err := t.get_rate(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(Rate{Currency: currency, Rate: rate})
+	} else if function == "get_all_rate" {
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_rate(stub)
+	} else if function == "get_budget_status" {
+		// (Entity [, FiscalYear]), the current year by default
+		if len(args) != 1 && len(args) != 2 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+		entity_record, err := t.get_entity(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		year_str := ""
+		if len(args) == 2 {
+			year_str = args[1]
+		}
+		year, err := t.parse_fiscal_year(stub, year_str, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		status, err := t.get_budget_status(stub, entity_record.Code, year)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(status)
+	} else if function == "get_entity" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		entity_record, err := t.get_entity(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(entity_record)
+	} else if function == "get_all_entity" {
+		entities, err := t.get_all_entities(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(entities)
+	} else if function == "get_all_amount" {
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_amount(stub)
+	} else if function == "get_beneficiary" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		beneficiary_record, err := t.get_beneficiary(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(beneficiary_record)
+	} else if function == "get_all_beneficiary" {
+		beneficiaries, err := t.get_all_beneficiaries(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(beneficiaries)
+	} else if function == "get_reservation_policy" {
+		config, err := t.get_reservation_config(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(config)
+	} else if function == "get_reservation" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		reservation, err := t.get_reservation(stub, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if reservation == nil {
+			return nil, errors.New("##### OpeEx1: project_id: " + args[0] + " has no reservation #####")
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(reservation)
+	} else if function == "get_validation_mode" {
+		v, err := t.get_validator(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(ValidationConfig{Mode: v.Mode})
+	} else if function == "get_rounding_mode" {
+		config, err := t.get_money_config(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(config)
+	} else if function == "get_consistency_rules" {
+		config, err := t.get_consistency_config(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(config)
+	} else if function == "validate_project" {
+		// ([ProjectId]), every project if empty
+		// Every rule is checked, enforced or not, so that records entered before
+		// the rules existed can be reviewed
+		project_id := ""
+		if len(args) > 0 {
+			project_id = args[0]
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.validate_project(stub, project_id)
+	} else if function == "get_amount_history" {
+		// (Entity [, FiscalYear]) or (Entity, "", From, To), dates as "2006-01-02"
+		// in the calendar time zone, To inclusive
+		if len(args) < 1 || len(args) > 4 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		entity := args[0]
+		_, err := t.get_entity(stub, entity)
+		if err != nil {
+			return nil, err
+		}
+		for len(args) < 4 {
+			args = append(args, "")
+		}
+		calendar, err := t.get_fiscal_calendar(stub)
+		if err != nil {
+			return nil, err
+		}
+		var from, to time.Time
+		if args[2] != "" || args[3] != "" {
+			if args[1] != "" {
+				return nil, errors.New("##### OpeEx1: Expecting either FiscalYear or From and To #####")
+			}
+			from, err = time.ParseInLocation("2006-01-02", args[2], calendar.location())
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Expecting From as YYYY-MM-DD #####")
+			}
+			to, err = time.ParseInLocation("2006-01-02", args[3], calendar.location())
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Expecting To as YYYY-MM-DD #####")
+			}
+			to = to.AddDate(0, 0, 1)
+		} else if args[1] != "" {
+			year, err := t.parse_fiscal_year(stub, args[1], time.Now())
+			if err != nil {
+				return nil, err
+			}
+			from, to = calendar.year_range(year)
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_amount_history(stub, entity, from, to)
+	} else if function == "audit_ledger" {
+		fmt.Println("Executing Query: " + function)
+		return t.audit_ledger(stub)
+	} else if function == "get_journal" {
+		// ([Account]), every entry if empty
+		if len(args) > 0 && args[0] != "" {
+			entries, err := t.get_account_journal(stub, args[0])
+			if err != nil {
+				return nil, err
+			}
+			fmt.Println("Executing Query: " + function)
+			return json.Marshal(entries)
+		}
+		fmt.Println("Executing Query: " + function)
+		return t.get_all_journal(stub)
+	} else if function == "get_journal_entry" {
+		if len(args) != 1 {
+			fmt.Printf("Incorrect number of arguments passed");
+			return nil, errors.New("##### OpeEx1: Query: Incorrect number of arguments passed #####")
+		}
+
+		sequence, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Expecting uint value for Sequence #####")
+		}
+		entry, err := t.get_journal_entry(stub, sequence)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(entry)
+	} else if function == "verify_journal" {
+		fmt.Println("Executing Query: " + function)
+		return t.verify_journal(stub)
+	} else if function == "get_fiscal_calendar" {
+		calendar, err := t.get_fiscal_calendar(stub)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(calendar)
+	} else if function == "get_fiscal_period" {
+		// ([Date]), Date as "2006-01-02" in the calendar time zone, empty for today
+		calendar, err := t.get_fiscal_calendar(stub)
+		if err != nil {
+			return nil, err
+		}
+		date := time.Now()
+		if len(args) > 0 && args[0] != "" {
+			date, err = time.ParseInLocation("2006-01-02", args[0], calendar.location())
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Expecting date as YYYY-MM-DD #####")
+			}
+		}
+		fmt.Println("Executing Query: " + function)
+		return json.Marshal(calendar.fiscal_period(date))
+	}	
+
+	// Error
+	fmt.Println("Query did not find function: " + function)
+	return nil, errors.New("##### OpeEx1: Received unknown function for Query #####")
+}
+
+//
+// named_args converts a JSON object argument to the positional arguments of function;
+// any other arguments are returned as they are
+//
+func (t *SimpleChaincode) named_args(function string, args []string, specs map[string][]ArgSpec) ([]string, error) {
+	if len(args) != 1 || !strings.HasPrefix(strings.TrimSpace(args[0]), "{") {
+		return args, nil
+	}
+	fields, ok := specs[function]
+	if !ok {
+		return nil, errors.New("##### OpeEx1: " + function + " does not take a JSON object argument #####")
+	}
+
+	var object	map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.UseNumber()
+	err := decoder.Decode(&object)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Expecting a JSON object argument for " + function + " #####")
+	}
+	v := &Validator{}
+	positional, trailing := flatten_args(v, "", object, fields)
+	err = v.error()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("named_args: %s takes %d positional arguments\n", function, len(positional) - trailing)
+	return positional[:len(positional) - trailing], nil
+}
+
+//
+// flatten_args appends the fields of object in positional order and counts the
+// optional fields without Default left out at the end; unknown and missing
+// fields are reported to v by name
+//
+func flatten_args(v *Validator, prefix string, object map[string]interface{}, fields []ArgSpec) ([]string, int) {
+	var positional	[]string
+
+	trailing := 0
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.Name] = true
+		value, ok := object[field.Name]
+		if !ok {
+			if !field.Optional {
+				v.fail(prefix + field.Name, "", "is missing")
+			}
+			if field.Counted {
+				positional = append(positional, LIST_MARK)
+			} else if field.Fields == nil && !field.Many {
+				positional = append(positional, field.Default)
+				if field.Default == "" {
+					trailing++
+				}
+			}
+			continue
+		}
+		trailing = 0
+		if field.Fields != nil {
+			items, ok := value.([]interface{})
+			if !ok {
+				v.fail(prefix + field.Name, "", "is not an array of objects")
+				continue
+			}
+			if field.Counted {
+				positional = append(positional, LIST_MARK + strconv.Itoa(len(items)))
+			}
+			for i, item := range items {
+				item_object, ok := item.(map[string]interface{})
+				if !ok {
+					v.fail(fmt.Sprintf("%s%s[%d]", prefix, field.Name, i), "", "is not an object")
+					continue
+				}
+				item_positional, _ := flatten_args(v, fmt.Sprintf("%s%s[%d].", prefix, field.Name, i), item_object, field.Fields)
+				positional = append(positional, item_positional...)
+			}
+		} else if field.Many {
+			items, ok := value.([]interface{})
+			if !ok {
+				v.fail(prefix + field.Name, "", "is not an array")
+				continue
+			}
+			for i, item := range items {
+				item_string, ok := arg_string(item)
+				if !ok {
+					v.fail(fmt.Sprintf("%s%s[%d]", prefix, field.Name, i), "", "is not a string, number or boolean")
+				}
+				positional = append(positional, item_string)
+			}
+		} else {
+			value_string, ok := arg_string(value)
+			if !ok {
+				v.fail(prefix + field.Name, "", "is not a string, number or boolean")
+			}
+			positional = append(positional, value_string)
+		}
+	}
+
+	// Sorted so that every peer reports the same error
+	var unknown	[]string
+	for name := range object {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		v.fail(prefix + name, "", "is not a known field")
+	}
+	return positional, trailing
+}
+
+//
+// arg_string converts a JSON value to a positional argument
+//
+func arg_string(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", true
+	}
+	return "", false
+}
+
+//
+// get username
+//
+func (t *SimpleChaincode) get_username(stub LedgerStub) (string, error) {
+	fmt.Println("Entering into get_username")
+	bytes, err := stub.GetCallerCertificate();
+	if err != nil {
+		return "", errors.New("Couldn't retrieve caller certificate")
+	}
+	x509Cert, err := x509.ParseCertificate(bytes);		// Extract Certificate from result of GetCallerCertificate						
+	if err != nil {
+		return "", errors.New("Couldn't parse certificate")
+	}
+															
+	fmt.Println("Returning from get_username")
+	return x509Cert.Subject.CommonName, nil
+}
+
+//
+// get_tx_time returns the timestamp of the current transaction
+//
+func (t *SimpleChaincode) get_tx_time(stub LedgerStub) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return time.Time{}, errors.New("##### OpeEx1: Failed to get transaction timestamp #####")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+//
+// get_stamp returns the Stamp of the record stored at key, or an empty Stamp
+//
+func (t *SimpleChaincode) get_stamp(stub LedgerStub, key string) (Stamp, error) {
+	var stamp	Stamp
+
+	record_asbytes, err := stub.GetState(key)
+	if err != nil {
+		return stamp, errors.New("##### OpeEx1: Failed to get state for key: " + key + " #####")
+	}
+	if record_asbytes == nil {
+		return stamp, nil
+	}
+	err = json.Unmarshal(record_asbytes, &stamp)
+	if err != nil {
+		return stamp, errors.New("##### OpeEx1: Error unmarshalling data " + string(record_asbytes) + " #####")
+	}
+	return stamp, nil
+}
+
+//
+// format_time writes a time as every record keeps it, RFC3339
+//
+func format_time(at time.Time) string {
+	return at.Format(time.RFC3339)
+}
+
+//
+// Stamp: touch sets updated_at, and created_at / created_tx on first write
+//
+func (s *Stamp) touch(now time.Time, tx_id string) {
+	at := format_time(now)
+	if s.CreatedAt == "" {
+		s.CreatedAt = at
+		s.CreatedTx = tx_id
+	}
+	s.UpdatedAt = at
+}
+
+//
+// normalize_currency
+//
+func (t *SimpleChaincode) normalize_currency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 {
+		return "", errors.New("##### OpeEx1: Expecting 3-letter currency code, got: " + currency + " #####")
+	}
+	return currency, nil
+}
+
+//
+// get_rate returns the normalized currency code and its rate to REPORTING_CURRENCY
+//
+func (t *SimpleChaincode) get_rate(stub LedgerStub, currency string) (string, Ratio, error) {
+	var rate_record	Rate
+
+	currency, err := t.normalize_currency(currency)
+	if err != nil {
+		return "", 0, err
+	}
+	if currency == REPORTING_CURRENCY {
+		return currency, RATIO_UNIT, nil
+	}
+	rate_asbytes, err := stub.GetState("rate/" + currency)
+	if err != nil {
+		return "", 0, errors.New("##### OpeEx1: Failed to get state for rate: " + currency + " #####")
+	}
+	if rate_asbytes == nil {
+		return "", 0, errors.New("##### OpeEx1: No rate has been registered for currency: " + currency + " #####")
+	}
+	err = json.Unmarshal(rate_asbytes, &rate_record)
+	if err != nil {
+		return "", 0, errors.New("##### OpeEx1: Error unmarshalling data " + string(rate_asbytes) + " #####")
+	}
+	return currency, rate_record.Rate, nil
+}
+
+//
+// get_fiscal_calendar returns the calendar kept on the ledger, or the
+// Japanese April-March calendar in JST if none has been set
+//
+func (t *SimpleChaincode) get_fiscal_calendar(stub LedgerStub) (FiscalCalendar, error) {
+	var calendar	FiscalCalendar
+
+	calendar_asbytes, err := stub.GetState("config/fiscal_calendar")
+	if err != nil {
+		return calendar, errors.New("##### OpeEx1: Failed to get state for fiscal calendar #####")
+	}
+	if calendar_asbytes == nil {
+		calendar = FiscalCalendar {
+			StartMonth:	4,
+			YearLabel:	FY_LABEL_START,
+			Quarters:	[]uint8{4, 7, 10, 1},
+			TimeZone:	"JST",
+			UTCOffset:	9 * 3600,
+		}
+		return calendar, nil
+	}
+	err = json.Unmarshal(calendar_asbytes, &calendar)
+	if err != nil {
+		return calendar, errors.New("##### OpeEx1: Error unmarshalling data " + string(calendar_asbytes) + " #####")
+	}
+	return calendar, nil
+}
+
+//
+// parse_fiscal_year accepts a fiscal year, or an empty string for the fiscal year of now
+//
+func (t *SimpleChaincode) parse_fiscal_year(stub LedgerStub, year_str string, now time.Time) (uint16, error) {
+	if year_str != "" {
+		year, err := strconv.ParseUint(year_str, 10, 16)
+		if err != nil {
+			return 0, errors.New("##### OpeEx1: Expecting uint value for Year #####")
+		}
+		return uint16(year), nil
+	}
+	calendar, err := t.get_fiscal_calendar(stub)
+	if err != nil {
+		return 0, err
+	}
+	return calendar.fiscal_year(now), nil
+}
+
+//
+// FiscalCalendar: validate
+//
+func (c FiscalCalendar) validate() error {
+	if len(c.Quarters) != 4 || c.Quarters[0] != c.StartMonth {
+		return errors.New("##### OpeEx1: Expecting 4 quarters, Q1 starting in StartMonth #####")
+	}
+	for i := 1; i < 4; i++ {
+		if c.month_offset(c.Quarters[i]) <= c.month_offset(c.Quarters[i - 1]) {
+			return errors.New("##### OpeEx1: Expecting quarter start months in fiscal order #####")
+		}
+	}
+	return nil
+}
+
+//
+// FiscalCalendar: location
+// A fixed offset is used rather than time.LoadLocation so that every peer
+// computes the same result regardless of its tz database.
+//
+func (c FiscalCalendar) location() *time.Location {
+	return time.FixedZone(c.TimeZone, c.UTCOffset)
+}
+
+//
+// FiscalCalendar: month_offset returns months elapsed since StartMonth (0-11)
+//
+func (c FiscalCalendar) month_offset(month uint8) int {
+	return (int(month) - int(c.StartMonth) + 12) % 12
+}
+
+//
+// FiscalCalendar: fiscal_year
+//
+func (c FiscalCalendar) fiscal_year(date time.Time) uint16 {
+	local := date.In(c.location())
+	start_year := local.Year()
+	if uint8(local.Month()) < c.StartMonth {
+		start_year = start_year - 1
+	}
+	if c.YearLabel == FY_LABEL_END && c.StartMonth != 1 {
+		return uint16(start_year + 1)
+	}
+	return uint16(start_year)
+}
+
+//
+// FiscalCalendar: fiscal_quarter
+//
+func (c FiscalCalendar) fiscal_quarter(date time.Time) uint8 {
+	offset := c.month_offset(uint8(date.In(c.location()).Month()))
+	quarter := uint8(1)
+	for i := 1; i < len(c.Quarters); i++ {
+		if offset >= c.month_offset(c.Quarters[i]) {
+			quarter = uint8(i + 1)
+		}
+	}
+	return quarter
+}
+
+//
+// FiscalCalendar: year_range returns the start (inclusive) and end (exclusive) of a fiscal year
+//
+func (c FiscalCalendar) year_range(year uint16) (time.Time, time.Time) {
+	start_year := int(year)
+	if c.YearLabel == FY_LABEL_END && c.StartMonth != 1 {
+		start_year = start_year - 1
+	}
+	start := time.Date(start_year, time.Month(c.StartMonth), 1, 0, 0, 0, 0, c.location())
+	return start, start.AddDate(1, 0, 0)
+}
+
+//
+// FiscalCalendar: fiscal_period
+//
+func (c FiscalCalendar) fiscal_period(date time.Time) FiscalPeriod {
+	year := c.fiscal_year(date)
+	start, end := c.year_range(year)
+	return FiscalPeriod {
+		Year:		year,
+		Quarter:	c.fiscal_quarter(date),
+		YearStart:	format_time(start),
+		YearEnd:	format_time(end),
+	}
+}
+
+//
+// get_roles
+//
+func (t *SimpleChaincode) get_roles(stub LedgerStub, user string) (UserRole, error) {
+	var role_record	UserRole
+
+	role_asbytes, err := stub.GetState("role/" + user)
+	if err != nil {
+		return role_record, errors.New("##### OpeEx1: Failed to get state for roles of user: " + user + " #####")
+	}
+	if role_asbytes == nil {
+		role_record.User = user
+		return role_record, nil
+	}
+	err = json.Unmarshal(role_asbytes, &role_record)
+	if err != nil {
+		return role_record, errors.New("##### OpeEx1: Error unmarshalling data " + string(role_asbytes) + " #####")
+	}
+	return role_record, nil
+}
+
+//
+// grant_role
+//
+func (t *SimpleChaincode) grant_role(stub LedgerStub, user string, role string) error {
+	fmt.Println("Entering into grant_role")
+	if user == "" || role == "" {
+		return errors.New("##### OpeEx1: Expecting user and role to be granted #####")
+	}
+	role_record, err := t.get_roles(stub, user)
+	if err != nil {
+		return err
+	}
+	for _, granted := range role_record.Roles {
+		if granted == role {
+			return nil
+		}
+	}
+	role_record.Roles = append(role_record.Roles, role)
+
+	bytes, err := json.Marshal(role_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new UserRole record #####")
+	}
+	err = stub.PutState("role/" + user, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for UserRole #####")
+	}
+	fmt.Printf("grant_role: %s has been granted %s\n", user, role)
+	return nil
+}
+
+//
+// check_role fails unless user has been granted role or ROLE_ADMIN
+//
+func (t *SimpleChaincode) check_role(stub LedgerStub, user string, role string) error {
+	role_record, err := t.get_roles(stub, user)
+	if err != nil {
+		return err
+	}
+	for _, granted := range role_record.Roles {
+		if granted == role || granted == ROLE_ADMIN {
+			return nil
+		}
+	}
+	return errors.New("##### OpeEx1: " + user + " is not authorized as " + role + " #####")
+}
+
+//
+// check_request reports whether request_id has been processed already; the
+// same request_id with another function or other args is refused
+//
+func (t *SimpleChaincode) check_request(stub LedgerStub, request_id string, function string, args []string) (bool, error) {
+	var request_record	ProcessedRequest
+
+	if request_id == "" {
+		return false, errors.New("##### OpeEx1: Expecting non-empty RequestId #####")
+	}
+	request_asbytes, err := stub.GetState("request/" + request_id)
+	if err != nil {
+		return false, errors.New("##### OpeEx1: Failed to get state for request_id: " + request_id + " #####")
+	}
+	if request_asbytes == nil {
+		return false, nil
+	}
+	err = json.Unmarshal(request_asbytes, &request_record)
+	if err != nil {
+		return false, errors.New("##### OpeEx1: Error unmarshalling data " + string(request_asbytes) + " #####")
+	}
+	if request_record.Function != function || strings.Join(request_record.Args, "\x00") != strings.Join(args, "\x00") {
+		return false, errors.New("##### OpeEx1: request_id: " + request_id + " has already been used for another request #####")
+	}
+	fmt.Printf("check_request: request_id: %s was processed in %s\n", request_id, request_record.CreatedTx)
+	return true, nil
+}
+
+//
+// put_request
+//
+func (t *SimpleChaincode) put_request(stub LedgerStub, request_id string, function string, args []string, user string, now time.Time, tx_id string) error {
+	request_record := ProcessedRequest {
+		RequestId:	request_id,
+		Function:	function,
+		Args:		args,
+		ProcessedBy:	user,
+	}
+	request_record.touch(now, tx_id)
+	bytes, err := json.Marshal(request_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new ProcessedRequest record #####")
+	}
+	err = stub.PutState("request/" + request_id, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for ProcessedRequest #####")
+	}
+	return nil
+}
+
+//
+// check_project_id refuses a project ID which would run into the keys of another
+// project under "issue/", "projectver/" or "amendment/"
+//
+func check_project_id(project_id string) error {
+	if project_id == "" || strings.ContainsAny(project_id, "/~") {
+		return errors.New("##### OpeEx1: Expecting project_id without \"/\" or \"~\" #####")
+	}
+	return nil
+}
+
+//
+// issue_key
+//
+func (t *SimpleChaincode) issue_key(project_id string, tranche uint32) string {
+	return fmt.Sprintf("issue/%s/%04d", project_id, tranche)
+}
+
+//
+// get_issue_tranches returns every tranche of a project in tranche order
+//
+func (t *SimpleChaincode) get_issue_tranches(stub LedgerStub, project_id string) ([]Issue, error) {
+	var tranches	[]Issue
+
+	// Record written before tranches existed
+	issue_asbytes, err := stub.GetState("issue/" + project_id)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if issue_asbytes != nil {
+		var issue_record Issue
+		err = json.Unmarshal(issue_asbytes, &issue_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
+		}
+		err = issue_record.normalize()
+		if err != nil {
+			return nil, err
+		}
+		tranches = append(tranches, issue_record)
+	}
+
+	iter, err := stub.RangeQueryState("issue/" + project_id + "/", "issue/" + project_id + "/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, issue_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var issue_record Issue
+		err = json.Unmarshal(issue_asbytes, &issue_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
+		}
+		tranches = append(tranches, issue_record)
+	}
+	return tranches, nil
+}
+
+//
+// Issue: normalize fills in fields missing from records written before tranches and currencies
+//
+func (i *Issue) normalize() error {
+	var err error
+
+	if i.Tranche == 0 {
+		i.Tranche = 1
+	}
+	if i.Kind == "" {
+		i.Kind = ISSUE_KIND_ISSUE
+	}
+	if i.ReportingAmount == 0 && i.IssueAmount != 0 {
+		if i.IssueRate == 0 {
+			i.IssueRate = RATIO_UNIT
+		}
+		i.ReportingAmount, err = i.IssueAmount.convert(i.IssueRate, LEGACY_ROUNDING)
+	}
+	return err
+}
+
+//
+// get_issue_tranche returns a tranche of a project and the key it is stored under
+//
+func (t *SimpleChaincode) get_issue_tranche(stub LedgerStub, project_id string, tranche uint32) (Issue, string, error) {
+	var issue_record	Issue
+
+	issue_key := t.issue_key(project_id, tranche)
+	issue_asbytes, err := stub.GetState(issue_key)
+	if err != nil {
+		return issue_record, "", errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if issue_asbytes == nil && tranche == 1 {
+		// Record written before tranches existed
+		issue_key = "issue/" + project_id
+		issue_asbytes, err = stub.GetState(issue_key)
+		if err != nil {
+			return issue_record, "", errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+		}
+	}
+	if issue_asbytes == nil {
+		return issue_record, "", errors.New("##### OpeEx1: Tranche " + strconv.FormatUint(uint64(tranche), 10) + " of project_id: " + project_id + " was not found #####")
+	}
+	err = json.Unmarshal(issue_asbytes, &issue_record)
+	if err != nil {
+		return issue_record, "", errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
+	}
+	err = issue_record.normalize()
+	if err != nil {
+		return issue_record, "", err
+	}
+	return issue_record, issue_key, nil
+}
+
+//
+// reverse_issue records a compensating tranche for amount (in the currency of the
+// original tranche, empty for all that remains) and takes it back from FG
+//
+func (t *SimpleChaincode) reverse_issue(stub LedgerStub, function string, project_id string, tranche_str string, amount_str string, reason string, now time.Time, tx_id string) error {
+	fmt.Println("Entering into reverse_issue")
+
+	tranche, err := strconv.ParseUint(tranche_str, 10, 32)
+	if err != nil {
+		return errors.New("##### OpeEx1: Expecting uint value for Tranche #####")
+	}
+	if reason == "" {
+		return errors.New("##### OpeEx1: Expecting reason for reversal #####")
+	}
+	original_record, original_key, err := t.get_issue_tranche(stub, project_id, uint32(tranche))
+	if err != nil {
+		return err
+	}
+	if original_record.Kind != ISSUE_KIND_ISSUE {
+		return errors.New("##### OpeEx1: Tranche " + tranche_str + " of project_id: " + project_id + " is itself a reversal #####")
+	}
+	remaining, err := original_record.IssueAmount.sub(original_record.ReversedAmount)
+	if err != nil {
+		return err
+	}
+	amount := remaining
+	if amount_str != "" {
+		amount, err = parse_money(amount_str)
+		if err != nil || amount <= 0 {
+			return errors.New("##### OpeEx1: Expecting positive decimal value for amount to be reversed #####")
+		}
+	}
+	if amount <= 0 || amount > remaining {
+		return errors.New("##### OpeEx1: Amount to be reversed exceeds remaining " + remaining.String() + " " + original_record.Currency + " of tranche " + tranche_str + " #####")
+	}
+	tranches, err := t.get_issue_tranches(stub, project_id)
+	if err != nil {
+		return err
+	}
+
+	// Reverse at the rate of the original tranche so FG gets back exactly what it received;
+	// the last reversal takes what earlier ones left so that rounding does not add up
+	money_config, err := t.get_money_config(stub)
+	if err != nil {
+		return err
+	}
+	reporting_amount, err := amount.convert(original_record.IssueRate, money_config.Rounding)
+	if err != nil {
+		return err
+	}
+	if amount == remaining {
+		reporting_amount = original_record.ReportingAmount
+		for _, other := range tranches {
+			if other.Kind == ISSUE_KIND_REVERSAL && other.Reverses == original_record.Tranche {
+				reporting_amount, err = reporting_amount.add(other.ReportingAmount)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	amount_record, err := t.get_amount(stub, original_record.Issuer)
+	if err != nil {
+		return err
+	}
+	if amount_record.Amount < reporting_amount {
+		return errors.New("##### OpeEx1: Reversal would make the amount of " + original_record.Issuer + " negative #####")
+	}
+
+	calendar, err := t.get_fiscal_calendar(stub)
+	if err != nil {
+		return err
+	}
+	reversal_record := Issue {
+		ProjectId:	project_id,
+		Tranche:	uint32(len(tranches) + 1),
+		Kind:		ISSUE_KIND_REVERSAL,
+		Reverses:	original_record.Tranche,
+		Reason:		reason,
+		Currency:	original_record.Currency,
+		IssueRate:	original_record.IssueRate,
+		IssueAmount:	-amount,
+		ReportingAmount:	-reporting_amount,
+		Issuer:		original_record.Issuer,
+		IssueYear:	calendar.fiscal_year(now),
+	}
+	reversal_record.touch(now, tx_id)
+	bytes, err := json.Marshal(reversal_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Issue record #####")
+	}
+	err = stub.PutState(t.issue_key(project_id, reversal_record.Tranche), []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Issue #####")
+	}
+
+	// Original stays as it was issued, only the reversed amount is tracked
+	original_record.ReversedAmount, err = original_record.ReversedAmount.add(amount)
+	if err != nil {
+		return err
+	}
+	original_record.touch(now, tx_id)
+	bytes, err = json.Marshal(original_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Issue record #####")
+	}
+	err = stub.PutState(original_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Issue #####")
+	}
+
+	err = t.post(stub, function, project_id, original_record.Issuer, ACCOUNT_ISSUE, -reporting_amount, now, tx_id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("reverse_issue: tranche %d of project_id: %s has been reversed by tranche %d\n", original_record.Tranche, project_id, reversal_record.Tranche)
+	return nil
+}
+
+//
+// get_amount
+//
+func (t *SimpleChaincode) get_amount(stub LedgerStub, entity string) (Amount, error) {
+	var amount_record	Amount
+
+	amount_asbytes, err := stub.GetState(entity)
+	if err != nil {
+		return amount_record, errors.New("##### OpeEx1: Failed to get state for " + entity + " #####")
+	}
+	if amount_asbytes == nil {
+		return amount_record, errors.New("##### OpeEx1: No amount has been registered for " + entity + " #####")
+	}
+	err = json.Unmarshal(amount_asbytes, &amount_record)
+	if err != nil {
+		return amount_record, errors.New("##### OpeEx1: Error unmarshalling data " + string(amount_asbytes) + " #####")
+	}
+	return amount_record, nil
+}
+
+//
+// Amount: available returns what the entity may still pay out, its amount less what is reserved
+//
+func (a Amount) available() (Money, error) {
+	return a.Amount.sub(a.Reserved)
+}
+
+//
+// Amount: cover fails if the entity has less available than amount to pay out for function
+//
+func (a Amount) cover(amount Money, function string) error {
+	available, err := a.available()
+	if err != nil {
+		return err
+	}
+	if available < amount {
+		return errors.New(fmt.Sprintf("##### OpeEx1: %s cannot cover %s for %s, available %s #####", a.Entity, amount, function, available))
+	}
+	return nil
+}
+
+//
+// add_amount adds delta (in REPORTING_CURRENCY) to the current amount of entity
+// and returns the new amount
+//
+func (t *SimpleChaincode) add_amount(stub LedgerStub, entity string, delta Money, now time.Time, tx_id string) (Money, error) {
+	_, err := t.get_active_entity(stub, entity, "")
+	if err != nil {
+		return 0, err
+	}
+	amount_record, err := t.get_amount(stub, entity)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("add_amount: current_amount for %s = %s\n", entity, amount_record.Amount)
+
+	amount_record.Amount, err = amount_record.Amount.add(delta)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("add_amount: new_amount for %s = %s\n", entity, amount_record.Amount)
+
+	err = t.put_amount(stub, amount_record, now, tx_id)
+	if err != nil {
+		return 0, err
+	}
+	return amount_record.Amount, nil
+}
+
+//
+// put_amount
+//
+func (t *SimpleChaincode) put_amount(stub LedgerStub, amount_record Amount, now time.Time, tx_id string) error {
+	amount_record.Currency = REPORTING_CURRENCY
+	amount_record.touch(now, tx_id)
+	bytes, err := json.Marshal(amount_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Amount record #####")
+	}
+	err = stub.PutState(amount_record.Entity, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state #####")
+	}
+	return nil
+}
+
+//
+// post moves amount from the credit account to the debit account through a
+// journal entry, a negative amount the other way, and updates the balances;
+// it fails if the credit entity has less available than amount
+//
+func (t *SimpleChaincode) post(stub LedgerStub, function string, project_id string, debit string, credit string, amount Money, now time.Time, tx_id string) error {
+	if amount == 0 {
+		return nil
+	}
+	if amount < 0 {
+		debit, credit, amount = credit, debit, -amount
+	}
+
+	// Nor take more than its budget for the year allows
+	err := t.check_budget(stub, debit, credit, amount, now)
+	if err != nil {
+		return err
+	}
+
+	// No entity may pay out more than it has available
+	if !is_pseudo_account(credit) {
+		amount_record, err := t.get_amount(stub, credit)
+		if err != nil {
+			return err
+		}
+		err = amount_record.cover(amount, function)
+		if err != nil {
+			return err
+		}
+	}
+	entry := JournalEntry {
+		TxId:		tx_id,
+		Function:	function,
+		ProjectId:	project_id,
+		Lines:		[]JournalLine {
+			{ Account: debit, Debit: amount },
+			{ Account: credit, Credit: amount },
+		},
+	}
+	err = t.write_journal(stub, &entry, now)
+	if err != nil {
+		return err
+	}
+	err = t.use_budget(stub, debit, credit, amount, now, tx_id)
+	if err != nil {
+		return err
+	}
+	for _, line := range entry.Lines {
+		if is_pseudo_account(line.Account) {
+			continue
+		}
+		delta, err := line.Debit.sub(line.Credit)
+		if err != nil {
+			return err
+		}
+		_, err = t.add_amount(stub, line.Account, delta, now, tx_id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// is_pseudo_account
+//
+func is_pseudo_account(account string) bool {
+	return strings.HasPrefix(account, "@")
+}
+
+//
+// get_journal_sequence returns the sequence of the last journal entry, 0 if there is none
+//
+func (t *SimpleChaincode) get_journal_sequence(stub LedgerStub) (uint64, error) {
+	seq_asbytes, err := stub.GetState("journal_seq")
+	if err != nil {
+		return 0, errors.New("##### OpeEx1: Failed to get state for journal_seq #####")
+	}
+	if seq_asbytes == nil {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseUint(string(seq_asbytes), 10, 64)
+	if err != nil {
+		return 0, errors.New("##### OpeEx1: Error parsing journal_seq " + string(seq_asbytes) + " #####")
+	}
+	return sequence, nil
+}
+
+//
+// write_journal numbers entry and writes it with its index, balances are left as they are
+//
+func (t *SimpleChaincode) write_journal(stub LedgerStub, entry *JournalEntry, now time.Time) error {
+	err := t.check_period_open(stub, now)
+	if err != nil {
+		return err
+	}
+
+	debit, credit, err := entry.totals()
+	if err != nil {
+		return err
+	}
+	if debit != credit {
+		return errors.New("##### OpeEx1: Journal entry of " + entry.Function + " is not balanced #####")
+	}
+
+	last, err := t.get_journal_sequence(stub)
+	if err != nil {
+		return err
+	}
+	entry.Sequence = last + 1
+	seq_str := strconv.FormatUint(entry.Sequence, 10)
+	err = stub.PutState("journal_seq", []byte(seq_str))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for journal_seq #####")
+	}
+
+	entry.touch(now, entry.TxId)
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new JournalEntry record #####")
+	}
+	err = stub.PutState(fmt.Sprintf("journal/%012d", entry.Sequence), []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for JournalEntry #####")
+	}
+	for _, line := range entry.Lines {
+		err = stub.PutState(fmt.Sprintf("journal_idx/%s/%012d", line.Account, entry.Sequence), []byte(seq_str))
+		if err != nil {
+			return errors.New("##### OpeEx1: Unable to put the state for journal index #####")
+		}
+	}
+	fmt.Printf("write_journal: entry %d of %s: %v\n", entry.Sequence, entry.Function, entry.Lines)
+	return nil
+}
+
+//
+// JournalEntry: totals returns the sums of the debits and of the credits of the lines
+//
+func (e *JournalEntry) totals() (Money, Money, error) {
+	var debit, credit	Money
+	var err			error
+
+	for _, line := range e.Lines {
+		debit, err = debit.add(line.Debit)
+		if err != nil {
+			return 0, 0, err
+		}
+		credit, err = credit.add(line.Credit)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return debit, credit, nil
+}
+
+//
+// JournalEntry: net returns the debits less the credits of the lines of account
+//
+func (e *JournalEntry) net(account string) (Money, error) {
+	var net	Money
+	var err	error
+
+	for _, line := range e.Lines {
+		if line.Account != account {
+			continue
+		}
+		net, err = net.add(line.Debit)
+		if err != nil {
+			return 0, err
+		}
+		net, err = net.sub(line.Credit)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return net, nil
+}
+
+//
+// AmountMovement: apply returns balance after the movement
+//
+func (m AmountMovement) apply(balance Money) (Money, error) {
+	balance, err := balance.add(m.Debit)
+	if err != nil {
+		return 0, err
+	}
+	return balance.sub(m.Credit)
+}
+
+//
+// get_journal_entry
+//
+func (t *SimpleChaincode) get_journal_entry(stub LedgerStub, sequence uint64) (JournalEntry, error) {
+	var entry	JournalEntry
+
+	entry_asbytes, err := stub.GetState(fmt.Sprintf("journal/%012d", sequence))
+	if err != nil {
+		return entry, errors.New("##### OpeEx1: Failed to get state for journal entry " + strconv.FormatUint(sequence, 10) + " #####")
+	}
+	if entry_asbytes == nil {
+		return entry, errors.New("##### OpeEx1: Journal entry " + strconv.FormatUint(sequence, 10) + " was not found #####")
+	}
+	err = json.Unmarshal(entry_asbytes, &entry)
+	if err != nil {
+		return entry, errors.New("##### OpeEx1: Error unmarshalling data " + string(entry_asbytes) + " #####")
+	}
+	return entry, nil
+}
+
+//
+// get_account_journal returns the journal entries of an account in sequence order
+//
+func (t *SimpleChaincode) get_account_journal(stub LedgerStub, account string) ([]JournalEntry, error) {
+	var entries	[]JournalEntry
+
+	iter, err := stub.RangeQueryState("journal_idx/" + account + "/", "journal_idx/" + account + "/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, seq_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		sequence, err := strconv.ParseUint(string(seq_asbytes), 10, 64)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error parsing journal index " + string(seq_asbytes) + " #####")
+		}
+		entry, err := t.get_journal_entry(stub, sequence)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+//
+// journal_balance returns debits less credits of an account
+//
+func (t *SimpleChaincode) journal_balance(stub LedgerStub, account string) (Money, error) {
+	var balance	Money
+
+	entries, err := t.get_account_journal(stub, account)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		net, err := entry.net(account)
+		if err != nil {
+			return 0, err
+		}
+		balance, err = balance.add(net)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return balance, nil
+}
+
+//
+// check_journal compares the balance of every entity with the journal
+//
+func (t *SimpleChaincode) check_journal(stub LedgerStub) ([]JournalCheck, error) {
+	var checks	[]JournalCheck
+
+	entities, err := t.get_all_entities(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity_record := range entities {
+		amount_record, err := t.get_amount(stub, entity_record.Code)
+		if err != nil {
+			return nil, err
+		}
+		journal_balance, err := t.journal_balance(stub, entity_record.Code)
+		if err != nil {
+			return nil, err
+		}
+		difference, err := amount_record.Amount.sub(journal_balance)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, JournalCheck {
+			Entity:		entity_record.Code,
+			Balance:	amount_record.Amount,
+			JournalBalance:	journal_balance,
+			Difference:	difference,
+		})
+	}
+	return checks, nil
+}
+
+//
+// verify_journal
+//
+func (t *SimpleChaincode) verify_journal(stub LedgerStub) ([]byte, error) {
+	fmt.Println("Entering into verify_journal")
+	var report	JournalReport
+
+	iter, err := stub.RangeQueryState("journal/", "journal/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, entry_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var entry JournalEntry
+		err = json.Unmarshal(entry_asbytes, &entry)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(entry_asbytes) + " #####")
+		}
+		report.Entries++
+		debit, credit, err := entry.totals()
+		if err != nil || debit != credit {
+			report.Unbalanced = append(report.Unbalanced, entry.Sequence)
+		}
+	}
+
+	checks, err := t.check_journal(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if check.Difference != 0 {
+			fmt.Printf("Query (verify_journal): %s: balance = %s, journal = %s\n", check.Entity, check.Balance, check.JournalBalance)
+			report.Mismatches = append(report.Mismatches, check)
+		}
+	}
+
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from verify_journal")
+	return []byte(bytes), nil
+}
+
+//
+// check_entity_code refuses a code which would run into other entities' keys or be
+// taken for a pseudo account such as ACCOUNT_ISSUE, which post lets pay out without cover
+//
+func check_entity_code(code string) error {
+	if code == "" || strings.ContainsAny(code, "/~") || is_pseudo_account(code) {
+		return errors.New("##### OpeEx1: Expecting entity code without \"/\" or \"~\", not starting with \"@\" #####")
+	}
+	return nil
+}
+
+//
+// get_entity
+//
+func (t *SimpleChaincode) get_entity(stub LedgerStub, code string) (Entity, error) {
+	var entity_record	Entity
+
+	if is_pseudo_account(code) {
+		return entity_record, errors.New("##### OpeEx1: entity: " + code + " is a reserved account, not an entity #####")
+	}
+	entity_asbytes, err := stub.GetState("entity/" + code)
+	if err != nil {
+		return entity_record, errors.New("##### OpeEx1: Failed to get state for entity: " + code + " #####")
+	}
+	if entity_asbytes == nil {
+		return entity_record, errors.New("##### OpeEx1: entity: " + code + " has not been registered #####")
+	}
+	err = json.Unmarshal(entity_asbytes, &entity_record)
+	if err != nil {
+		return entity_record, errors.New("##### OpeEx1: Error unmarshalling data " + string(entity_asbytes) + " #####")
+	}
+	return entity_record, nil
+}
+
+//
+// Entity: has_member
+//
+func (e *Entity) has_member(user string) bool {
+	for _, member := range e.Members {
+		if member == user {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// get_active_entity fails unless entity is registered, active and, if role is given, has that role
+//
+func (t *SimpleChaincode) get_active_entity(stub LedgerStub, code string, role string) (Entity, error) {
+	entity_record, err := t.get_entity(stub, code)
+	if err != nil {
+		return entity_record, err
+	}
+	if !entity_record.Active {
+		return entity_record, errors.New("##### OpeEx1: entity: " + code + " has been deactivated #####")
+	}
+	if role != "" && entity_record.Role != role {
+		return entity_record, errors.New("##### OpeEx1: entity: " + code + " is not " + role + " #####")
+	}
+	return entity_record, nil
+}
+
+//
+// get_all_entities returns every registered entity in code order
+//
+func (t *SimpleChaincode) get_all_entities(stub LedgerStub) ([]Entity, error) {
+	var entity_set	EntitySet
+
+	iter, err := stub.RangeQueryState("entity/", "entity/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, entity_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var entity_record Entity
+		err = json.Unmarshal(entity_asbytes, &entity_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(entity_asbytes) + " #####")
+		}
+		entity_set.Entities = append(entity_set.Entities, entity_record)
+	}
+	return entity_set.Entities, nil
+}
+
+//
+// get_issuer returns the code of the active issuer entity
+//
+func (t *SimpleChaincode) get_issuer(stub LedgerStub) (string, error) {
+	entities, err := t.get_all_entities(stub)
+	if err != nil {
+		return "", err
+	}
+	for _, entity_record := range entities {
+		if entity_record.Active && entity_record.Role == ENTITY_ROLE_ISSUER {
+			return entity_record.Code, nil
+		}
+	}
+	return "", errors.New("##### OpeEx1: No active issuer entity has been registered #####")
+}
+
+//
+// put_entity
+//
+func (t *SimpleChaincode) put_entity(stub LedgerStub, entity_record Entity, now time.Time, tx_id string) error {
+	var err		error
+
+	entity_key := "entity/" + entity_record.Code
+	entity_record.Stamp, err = t.get_stamp(stub, entity_key)
+	if err != nil {
+		return err
+	}
+	entity_record.touch(now, tx_id)
+	bytes, err := json.Marshal(entity_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Entity record #####")
+	}
+	err = stub.PutState(entity_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Entity #####")
+	}
+	return nil
+}
+
+//
+// parse_participant_args splits args into groups of (Entity, Dept, Team, Person, Amount)
+//
+func (t *SimpleChaincode) parse_participant_args(args []string) ([]ParticipantArgs, error) {
+	var participants	[]ParticipantArgs
+
+	if len(args) == 0 || len(args) % 5 != 0 {
+		return nil, errors.New("##### OpeEx1: Expecting participants as groups of (Entity, Dept, Team, Person, Amount) #####")
+	}
+	for i := 0; i < len(args); i += 5 {
+		participants = append(participants, ParticipantArgs {
+			Entity:	args[i],
+			Dept:	args[i + 1],
+			Team:	args[i + 2],
+			Person:	args[i + 3],
+			Amount:	args[i + 4],
+		})
+	}
+	return participants, nil
+}
+
+//
+// parse_slot_args maps the three-slot (Dept, Team, Person, Amount) x BK/SC/TB arguments to participants
+//
+func (t *SimpleChaincode) parse_slot_args(args []string) []ParticipantArgs {
+	var participants	[]ParticipantArgs
+
+	for i, entity := range []string{"BK", "SC", "TB"} {
+		participants = append(participants, ParticipantArgs {
+			Entity:	entity,
+			Dept:	args[i * 4],
+			Team:	args[i * 4 + 1],
+			Person:	args[i * 4 + 2],
+			Amount:	args[i * 4 + 3],
+		})
+	}
+	return participants
+}
+
+//
+// parse_project_args
+//
+func (t *SimpleChaincode) parse_project_args(args []string) (ProjectArgs, error) {
+	var project_args	ProjectArgs
+	var err			error
+
+	if len(args) < 5 {
+		return project_args, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 21, 9 + 5 x participants or 5 + 2 x beneficiaries + 5 x participants arguments for project #####")
+	}
+	project_args = ProjectArgs {
+		ProjectId:	args[0],
+		ProjectName:	args[1],
+		InvestType:	args[2],
+		InvestAmount:	args[3],
+	}
+
+	// Counted form, "#" alone keeps the beneficiaries as they are
+	if strings.HasPrefix(args[4], LIST_MARK) {
+		count := 0
+		if args[4] == LIST_MARK {
+			project_args.KeepOthers = true
+		} else {
+			count, err = strconv.Atoi(args[4][len(LIST_MARK):])
+			if err != nil || count < 0 {
+				return project_args, errors.New("##### OpeEx1: Expecting " + LIST_MARK + " and the number of beneficiaries, not " + args[4] + " #####")
+			}
+		}
+		if len(args) < 5 + count * 2 {
+			return project_args, errors.New("##### OpeEx1: Expecting " + strconv.Itoa(count) + " beneficiaries as (Code, Percent) #####")
+		}
+		for i := 0; i < count; i++ {
+			project_args.Beneficiaries = append(project_args.Beneficiaries, BeneficiaryArgs{Code: args[5 + i * 2], Percent: args[6 + i * 2]})
+		}
+		project_args.Participants, err = t.parse_participant_args(args[5 + count * 2:])
+		if err != nil {
+			return project_args, err
+		}
+		return project_args, nil
+	}
+
+	// Fixed columns of the five LEGACY_BENEFICIARIES, any other beneficiary is kept
+	if len(args) < 14 {
+		return project_args, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 21, 9 + 5 x participants or 5 + 2 x beneficiaries + 5 x participants arguments for project #####")
+	}
+	for i, code := range LEGACY_BENEFICIARIES {
+		project_args.Beneficiaries = append(project_args.Beneficiaries, BeneficiaryArgs{Code: code, Percent: args[4 + i]})
+	}
+	project_args.KeepOthers = true
+	if len(args) == 21 {
+		project_args.Participants = t.parse_slot_args(args[9:])
+	} else {
+		project_args.Participants, err = t.parse_participant_args(args[9:])
+		if err != nil {
+			return project_args, err
+		}
+	}
+	return project_args, nil
+}
+
+//
+// parse_receivable_args
+//
+func (t *SimpleChaincode) parse_receivable_args(args []string) (ReceivableArgs, error) {
+	var receivable_args	ReceivableArgs
+
+	if len(args) < 2 {
+		return receivable_args, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 11, 12 or 2 + 3 x beneficiaries arguments for receivable #####")
+	}
+
+	// The fixed form has AMCPercent where the other has a 3-letter currency code
+	if (len(args) == 11 || len(args) == 12) && (is_number(args[1]) || len(args[1]) != 3) {
+		receivable_args = ReceivableArgs {
+			ProjectId:	args[0],
+			Currency:	REPORTING_CURRENCY,
+		}
+		for i, code := range LEGACY_BENEFICIARIES {
+			receivable_args.Beneficiaries = append(receivable_args.Beneficiaries, BeneficiaryArgs {
+				Code:		code,
+				Percent:	args[1 + i * 2],
+				Amount:		args[2 + i * 2],
+			})
+		}
+		if len(args) == 12 {
+			receivable_args.Currency = args[11]
+		}
+		return receivable_args, nil
+	}
+	if len(args) < 5 || (len(args) - 2) % 3 != 0 {
+		return receivable_args, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 11, 12 or 2 + 3 x beneficiaries arguments for receivable #####")
+	}
+	receivable_args = ReceivableArgs {
+		ProjectId:	args[0],
+		Currency:	args[1],
+	}
+	for i := 2; i < len(args); i += 3 {
+		receivable_args.Beneficiaries = append(receivable_args.Beneficiaries, BeneficiaryArgs {
+			Code:		args[i],
+			Percent:	args[i + 1],
+			Amount:		args[i + 2],
+		})
+	}
+	return receivable_args, nil
+}
+
+//
+// parse_distribution_args
+//
+func (t *SimpleChaincode) parse_distribution_args(args []string) (DistributionArgs, error) {
+	var distribution_args	DistributionArgs
+	var err			error
+
+	if len(args) == 14 || len(args) == 15 {
+		distribution_args = DistributionArgs {
+			ProjectId:	args[0],
+			IssueAmount:	args[1],
+			Currency:	REPORTING_CURRENCY,
+			Participants:	t.parse_slot_args(args[2:14]),
+		}
+		if len(args) == 15 {
+			distribution_args.Currency = args[14]
+		}
+		return distribution_args, nil
+	}
+	if len(args) < 8 {
+		return distribution_args, errors.New("##### OpeEx1: Incorrect number of arguments. Expecting 14, 15 or 3 + 5 x participants arguments for distribution #####")
+	}
+	distribution_args = DistributionArgs {
+		ProjectId:	args[0],
+		IssueAmount:	args[1],
+		Currency:	args[2],
+	}
+	distribution_args.Participants, err = t.parse_participant_args(args[3:])
+	if err != nil {
+		return distribution_args, err
+	}
+	return distribution_args, nil
+}
+
+//
+// make_participants checks each entity against the registry; an entity whose
+// amount is NOT_PARTICIPATING does not participate
+//
+func (t *SimpleChaincode) make_participants(stub LedgerStub, v *Validator, participant_args []ParticipantArgs) []Participant {
+	var participants	[]Participant
+
+	seen := map[string]bool{}
+	for i, args := range participant_args {
+		field := fmt.Sprintf("participants[%d]", i)
+		if args.Amount == NOT_PARTICIPATING {
+			fmt.Printf("make_participants: %s is not participating\n", args.Entity)
+			continue
+		}
+		amount := v.amount(field + ".amount", args.Amount)
+		if seen[args.Entity] {
+			v.fail(field + ".entity", args.Entity, "appears more than once")
+			continue
+		}
+		seen[args.Entity] = true
+		_, err := t.get_active_entity(stub, args.Entity, ENTITY_ROLE_PARTICIPANT)
+		if err != nil {
+			v.fail(field + ".entity", args.Entity, "is not an active participant entity")
+			continue
+		}
+		participants = append(participants, Participant {
+			Entity:		args.Entity,
+			Dept:		args.Dept,
+			Team:		args.Team,
+			Person:		args.Person,
+			Amount:		amount,
+		})
+	}
+	return participants
+}
+
+//
+// make_beneficiary_shares checks each beneficiary against the registry; a share
+// with neither percent nor amount is left out, amounts are read only with_amount
+//
+func (t *SimpleChaincode) make_beneficiary_shares(stub LedgerStub, v *Validator, beneficiary_args []BeneficiaryArgs, with_amount bool) []BeneficiaryShare {
+	var shares	[]BeneficiaryShare
+
+	seen := map[string]bool{}
+	for i, args := range beneficiary_args {
+		field := fmt.Sprintf("beneficiaries[%d]", i)
+		percent := v.percent(field + ".percent", args.Percent)
+		var amount Money
+		if with_amount {
+			amount = v.amount(field + ".amount", args.Amount)
+		}
+		if percent == 0 && amount == 0 {
+			continue
+		}
+		if seen[args.Code] {
+			v.fail(field + ".code", args.Code, "appears more than once")
+			continue
+		}
+		seen[args.Code] = true
+		beneficiary_record, err := t.get_beneficiary(stub, args.Code)
+		if err != nil {
+			v.fail(field + ".code", args.Code, "has not been registered")
+			continue
+		}
+		if !beneficiary_record.Active {
+			v.fail(field + ".code", args.Code, "has been retired")
+			continue
+		}
+		shares = append(shares, BeneficiaryShare {
+			Code:		args.Code,
+			Percent:	percent,
+			Amount:		amount,
+		})
+	}
+	return shares
+}
+
+//
+// get_consistency_config
+//
+func (t *SimpleChaincode) get_consistency_config(stub LedgerStub) (ConsistencyConfig, error) {
+	var config	ConsistencyConfig
+
+	config_asbytes, err := stub.GetState("config/consistency")
+	if err != nil {
+		return config, errors.New("##### OpeEx1: Failed to get state for config/consistency #####")
+	}
+	config.Tolerance = MONEY_UNIT / 200		// 0.005
+	config.PercentTolerance = DEFAULT_PERCENT_TOLERANCE
+	if config_asbytes != nil {
+		err = json.Unmarshal(config_asbytes, &config)
+		if err != nil {
+			return config, errors.New("##### OpeEx1: Error unmarshalling data " + string(config_asbytes) + " #####")
+		}
+	}
+	return config, nil
+}
+
+//
+// Project: check_consistency adds a ValidationError to v for each rule the project breaks
+//
+func (p *Project) check_consistency(v *Validator, rules []string, tolerance Money, percent_tolerance Ratio) {
+	for _, rule := range rules {
+		if rule == RULE_BENEFICIARY_PERCENT {
+			var total Ratio
+			var err error
+			for _, share := range p.Beneficiaries {
+				total, err = total.add(share.Percent)
+				if err != nil {
+					break
+				}
+			}
+			if err != nil {
+				v.fail("beneficiaries", "", "percents add up to more than can be held (" + rule + ")")
+			} else if (total - 100 * RATIO_UNIT).abs() > percent_tolerance {
+				v.fail("beneficiaries", total.String(), "percents add up to this, expecting 100 (" + rule + ")")
+			}
+		} else if rule == RULE_PARTICIPANT_AMOUNT {
+			var total, difference Money
+			var err error
+			for _, participant := range p.Participants {
+				total, err = total.add(participant.Amount)
+				if err != nil {
+					break
+				}
+			}
+			if err == nil {
+				difference, err = total.sub(p.InvestAmount)
+			}
+			if err != nil {
+				v.fail("participants", "", "amounts add up to more than can be held (" + rule + ")")
+			} else if difference.abs() > tolerance {
+				v.fail("participants", total.String(),
+					"amounts add up to this, expecting invest_amount " + p.InvestAmount.String() + " (" + rule + ")")
+			}
+		}
+	}
+}
+
+//
+// get_validator returns an empty Validator in the configured mode
+//
+func (t *SimpleChaincode) get_validator(stub LedgerStub) (*Validator, error) {
+	var config	ValidationConfig
+
+	config_asbytes, err := stub.GetState("config/validation")
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for config/validation #####")
+	}
+	config.Mode = VALIDATION_LENIENT
+	if config_asbytes != nil {
+		err = json.Unmarshal(config_asbytes, &config)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(config_asbytes) + " #####")
+		}
+	}
+	return &Validator{Mode: config.Mode}, nil
+}
+
+//
+// pow10
+//
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+//
+// round_rat rounds r to an integer in mode; exact is false if r was not one
+//
+func round_rat(r *big.Rat, mode string) (*big.Int, bool) {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() == 0 {
+		return q, true
+	}
+	if mode != ROUND_DOWN {
+		twice := new(big.Int).Lsh(new(big.Int).Abs(m), 1)
+		c := twice.Cmp(r.Denom())
+		if c > 0 || (c == 0 && (mode == ROUND_HALF_UP || q.Bit(0) == 1)) {
+			if r.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return q, false
+}
+
+//
+// parse_decimal reads a decimal number as a multiple of 10^-scale, rounding any
+// further digits in mode; exact is false if it had to round
+//
+func parse_decimal(value string, scale int, mode string) (int64, bool, error) {
+	value = strings.TrimSpace(value)
+	if !DECIMAL_SYNTAX.MatchString(value) {
+		return 0, false, errors.New("##### OpeEx1: " + value + " is not a number #####")
+	}
+	return scale_decimal(value, scale, mode)
+}
+
+//
+// scale_decimal reads a number already checked against DECIMAL_SYNTAX or JSON_NUMBER_SYNTAX
+//
+func scale_decimal(value string, scale int, mode string) (int64, bool, error) {
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, false, errors.New("##### OpeEx1: " + value + " is not a number #####")
+	}
+	n, exact := round_rat(r.Mul(r, new(big.Rat).SetInt(pow10(scale))), mode)
+	if n.BitLen() > 63 {
+		return 0, false, errors.New("##### OpeEx1: " + value + " is out of range #####")
+	}
+	return n.Int64(), exact, nil
+}
+
+//
+// format_decimal writes n * 10^-scale with scale places
+//
+func format_decimal(n int64, scale int) string {
+	sign := ""
+	if n < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(big.NewInt(n)).String()
+	for len(digits) <= scale {
+		digits = "0" + digits
+	}
+	return sign + digits[:len(digits) - scale] + "." + digits[len(digits) - scale:]
+}
+
+//
+// unmarshal_decimal reads a decimal string, or a number written before Money existed
+//
+func unmarshal_decimal(data []byte, scale int) (int64, error) {
+	text := string(data)
+	if text == "null" {
+		return 0, nil
+	}
+	if strings.HasPrefix(text, "\"") {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return 0, err
+		}
+		n, _, err := parse_decimal(text, scale, LEGACY_ROUNDING)
+		return n, err
+	}
+	if !JSON_NUMBER_SYNTAX.MatchString(text) {
+		return 0, errors.New("##### OpeEx1: " + text + " is not a number #####")
+	}
+	n, _, err := scale_decimal(text, scale, LEGACY_ROUNDING)
+	return n, err
+}
+
+//
+// parse_money reads an amount with at most MONEY_SCALE places
+//
+func parse_money(value string) (Money, error) {
+	n, exact, err := parse_decimal(value, MONEY_SCALE, ROUND_DOWN)
+	if err != nil {
+		return 0, err
+	}
+	if !exact {
+		return 0, errors.New("##### OpeEx1: " + value + " has more than " + strconv.Itoa(MONEY_SCALE) + " decimal places #####")
+	}
+	return Money(n), nil
+}
+
+//
+// parse_ratio reads a rate or percent with at most RATIO_SCALE places
+//
+func parse_ratio(value string) (Ratio, error) {
+	n, exact, err := parse_decimal(value, RATIO_SCALE, ROUND_DOWN)
+	if err != nil {
+		return 0, err
+	}
+	if !exact {
+		return 0, errors.New("##### OpeEx1: " + value + " has more than " + strconv.Itoa(RATIO_SCALE) + " decimal places #####")
+	}
+	return Ratio(n), nil
+}
+
+//
+// Money: String
+//
+func (m Money) String() string {
+	return format_decimal(int64(m), MONEY_SCALE)
+}
+
+//
+// Money: MarshalJSON
+//
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+//
+// Money: UnmarshalJSON
+//
+func (m *Money) UnmarshalJSON(data []byte) error {
+	n, err := unmarshal_decimal(data, MONEY_SCALE)
+	*m = Money(n)
+	return err
+}
+
+//
+// Money: abs
+//
+func (m Money) abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+//
+// Money: add returns m + d, or an error where the sum does not fit in a Money
+//
+func (m Money) add(d Money) (Money, error) {
+	sum := m + d
+	if (d > 0 && sum < m) || (d < 0 && sum > m) {
+		return 0, errors.New("##### OpeEx1: " + m.String() + " + " + d.String() + " is out of range #####")
+	}
+	return sum, nil
+}
+
+//
+// Money: sub returns m - d, or an error where the difference does not fit in a Money
+//
+func (m Money) sub(d Money) (Money, error) {
+	difference := m - d
+	if (d > 0 && difference > m) || (d < 0 && difference < m) {
+		return 0, errors.New("##### OpeEx1: " + m.String() + " - " + d.String() + " is out of range #####")
+	}
+	return difference, nil
+}
+
+//
+// Money: convert returns m at rate, rounded to MONEY_SCALE in mode
+//
+func (m Money) convert(rate Ratio, mode string) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(rate)))
+	n, _ := round_rat(new(big.Rat).SetFrac(product, pow10(RATIO_SCALE)), mode)
+	if n.BitLen() > 63 {
+		return 0, errors.New("##### OpeEx1: " + m.String() + " at rate " + rate.String() + " is out of range #####")
+	}
+	return Money(n.Int64()), nil
+}
+
+//
+// Money: ratio returns m as a Ratio, to compare with percents
+//
+func (m Money) ratio() Ratio {
+	return Ratio(int64(m) * (RATIO_UNIT / MONEY_UNIT))
+}
+
+//
+// Ratio: String
+//
+func (r Ratio) String() string {
+	return format_decimal(int64(r), RATIO_SCALE)
+}
+
+//
+// Ratio: MarshalJSON
+//
+func (r Ratio) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+//
+// Ratio: UnmarshalJSON
+//
+func (r *Ratio) UnmarshalJSON(data []byte) error {
+	n, err := unmarshal_decimal(data, RATIO_SCALE)
+	*r = Ratio(n)
+	return err
+}
+
+//
+// Ratio: abs
+//
+func (r Ratio) abs() Ratio {
+	if r < 0 {
+		return -r
+	}
+	return r
+}
+
+//
+// Ratio: add returns r + d, or an error where the sum does not fit in a Ratio
+//
+func (r Ratio) add(d Ratio) (Ratio, error) {
+	sum := r + d
+	if (d > 0 && sum < r) || (d < 0 && sum > r) {
+		return 0, errors.New("##### OpeEx1: " + r.String() + " + " + d.String() + " is out of range #####")
+	}
+	return sum, nil
+}
+
+//
+// get_money_config
+//
+func (t *SimpleChaincode) get_money_config(stub LedgerStub) (MoneyConfig, error) {
+	var config	MoneyConfig
+
+	config_asbytes, err := stub.GetState("config/money")
+	if err != nil {
+		return config, errors.New("##### OpeEx1: Failed to get state for config/money #####")
+	}
+	config.Rounding = ROUND_HALF_UP
+	if config_asbytes != nil {
+		err = json.Unmarshal(config_asbytes, &config)
+		if err != nil {
+			return config, errors.New("##### OpeEx1: Error unmarshalling data " + string(config_asbytes) + " #####")
+		}
+	}
+	return config, nil
+}
+
+//
+// migrate_money reads every record holding amounts, rates or percents and writes
+// back those whose JSON changes; numbers become decimal strings, rounded in
+// LEGACY_ROUNDING where they have more places than Money or Ratio keeps
+//
+func (t *SimpleChaincode) migrate_money(stub LedgerStub) (MoneyMigration, error) {
+	fmt.Println("Entering into migrate_money")
+	var migration	MoneyMigration
+
+	rewrite := func(key string, record_asbytes []byte, record interface{}) error {
+		migration.Keys++
+		err := json.Unmarshal(record_asbytes, record)
+		if err != nil {
+			return errors.New("##### OpeEx1: Error unmarshalling data " + string(record_asbytes) + " #####")
+		}
+		bytes, err := json.Marshal(record)
+		if err != nil {
+			return errors.New("##### OpeEx1: Error creating migrated record for " + key + " #####")
+		}
+		if string(bytes) == string(record_asbytes) {
+			return nil
+		}
+		err = stub.PutState(key, bytes)
+		if err != nil {
+			return errors.New("##### OpeEx1: Unable to put the state for " + key + " #####")
+		}
+		migration.Rewritten++
+		return nil
+	}
+
+	// Balances, under the code of each entity
+	entities, err := t.get_all_entities(stub)
+	if err != nil {
+		return migration, err
+	}
+	for _, entity_record := range entities {
+		amount_asbytes, err := stub.GetState(entity_record.Code)
+		if err != nil {
+			return migration, errors.New("##### OpeEx1: Failed to get state for amount: " + entity_record.Code + " #####")
+		}
+		if amount_asbytes == nil {
+			continue
+		}
+		err = rewrite(entity_record.Code, amount_asbytes, &Amount{})
+		if err != nil {
+			return migration, err
+		}
+	}
+
+	config_asbytes, err := stub.GetState("config/consistency")
+	if err != nil {
+		return migration, errors.New("##### OpeEx1: Failed to get state for config/consistency #####")
+	}
+	if config_asbytes != nil {
+		err = rewrite("config/consistency", config_asbytes, &ConsistencyConfig{})
+		if err != nil {
+			return migration, err
+		}
+	}
+
+	// Records kept under a prefix, each read into a new record of its type;
+	// read in full before any is written back
+	records := map[string]func() interface{} {
+		"rate/":		func() interface{} { return &Rate{} },
+		"issue/":		func() interface{} { return &Issue{} },
+		"project/":		func() interface{} { return &Project{} },
+		"projectver/":		func() interface{} { return &ProjectVersion{} },
+		"amendment/":		func() interface{} { return &Amendment{} },
+		"distribution/":	func() interface{} { return &Distribution{} },
+		"receivable/":		func() interface{} { return &Receivable{} },
+		"reservation/":		func() interface{} { return &Reservation{} },
+		"journal/":		func() interface{} { return &JournalEntry{} },
+	}
+	var prefixes	[]string
+	for prefix := range records {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		var keys	[]string
+		var values	[][]byte
+		iter, err := stub.RangeQueryState(prefix, prefix + "~")
+		if err != nil {
+			return migration, errors.New("Unable to start the iterator")
+		}
+		for iter.HasNext() {
+			key, record_asbytes, iterErr := iter.Next()
+			if iterErr != nil {
+				iter.Close()
+				return migration, errors.New("keys operation failed. Error accessing next state")
+			}
+			keys = append(keys, key)
+			values = append(values, record_asbytes)
+		}
+		iter.Close()
+		for i, key := range keys {
+			err = rewrite(key, values[i], records[prefix]())
+			if err != nil {
+				return migration, err
+			}
+		}
+	}
+
+	fmt.Println("Returning from migrate_money")
+	return migration, nil
+}
+
+//
+// is_number
+//
+func is_number(value string) bool {
+	return DECIMAL_SYNTAX.MatchString(strings.TrimSpace(value))
+}
+
+//
+// Validator: fail
+//
+func (v *Validator) fail(field string, value string, message string) {
+	v.Errors = append(v.Errors, ValidationError{Field: field, Value: value, Message: message})
+}
+
+//
+// Validator: amount parses an amount, in strict mode non-negative with at most MONEY_SCALE places
+//
+func (v *Validator) amount(field string, value string) Money {
+	if v.Mode != VALIDATION_STRICT {
+		n, _, err := parse_decimal(value, MONEY_SCALE, LEGACY_ROUNDING)
+		if err != nil {
+			v.fail(field, value, "is not a number")
+		}
+		return Money(n)
+	}
+	amount, err := parse_money(value)
+	if err != nil {
+		if is_number(value) {
+			v.fail(field, value, "has more than " + strconv.Itoa(MONEY_SCALE) + " decimal places")
+		} else {
+			v.fail(field, value, "is not a number")
+		}
+	} else if amount < 0 {
+		v.fail(field, value, "is negative")
+	}
+	return amount
+}
+
+//
+// Validator: percent parses a percent between 0 and 100 with at most RATIO_SCALE places
+//
+func (v *Validator) percent(field string, value string) Ratio {
+	if v.Mode != VALIDATION_STRICT {
+		n, _, err := parse_decimal(value, RATIO_SCALE, LEGACY_ROUNDING)
+		if err != nil {
+			return 0
+		}
+		return Ratio(n)
+	}
+	percent, err := parse_ratio(value)
+	if err != nil {
+		if is_number(value) {
+			v.fail(field, value, "has more than " + strconv.Itoa(RATIO_SCALE) + " decimal places")
+		} else {
+			v.fail(field, value, "is not a number")
+		}
+	} else if percent < 0 || percent > 100 * RATIO_UNIT {
+		v.fail(field, value, "is not between 0 and 100")
+	}
+	return percent
+}
+
+//
+// Validator: error returns every ValidationError as a JSON payload, nil if there is none
+//
+func (v *Validator) error() error {
+	if len(v.Errors) == 0 {
+		return nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating ValidationError payload #####")
+	}
+	return errors.New("##### OpeEx1: Validation failed " + string(bytes) + " #####")
+}
+
+//
+// get_beneficiary
+//
+func (t *SimpleChaincode) get_beneficiary(stub LedgerStub, code string) (Beneficiary, error) {
+	var beneficiary_record	Beneficiary
+
+	beneficiary_asbytes, err := stub.GetState("beneficiary/" + code)
+	if err != nil {
+		return beneficiary_record, errors.New("##### OpeEx1: Failed to get state for beneficiary: " + code + " #####")
+	}
+	if beneficiary_asbytes == nil {
+		return beneficiary_record, errors.New("##### OpeEx1: beneficiary: " + code + " has not been registered #####")
+	}
+	err = json.Unmarshal(beneficiary_asbytes, &beneficiary_record)
+	if err != nil {
+		return beneficiary_record, errors.New("##### OpeEx1: Error unmarshalling data " + string(beneficiary_asbytes) + " #####")
+	}
+	return beneficiary_record, nil
+}
+
+//
+// get_all_beneficiaries returns every registered beneficiary in code order
+//
+func (t *SimpleChaincode) get_all_beneficiaries(stub LedgerStub) ([]Beneficiary, error) {
+	var beneficiary_set	BeneficiarySet
+
+	iter, err := stub.RangeQueryState("beneficiary/", "beneficiary/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, beneficiary_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var beneficiary_record Beneficiary
+		err = json.Unmarshal(beneficiary_asbytes, &beneficiary_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(beneficiary_asbytes) + " #####")
+		}
+		beneficiary_set.Beneficiaries = append(beneficiary_set.Beneficiaries, beneficiary_record)
+	}
+	return beneficiary_set.Beneficiaries, nil
+}
+
+//
+// put_beneficiary
+//
+func (t *SimpleChaincode) put_beneficiary(stub LedgerStub, beneficiary_record Beneficiary, now time.Time, tx_id string) error {
+	var err		error
+
+	beneficiary_key := "beneficiary/" + beneficiary_record.Code
+	beneficiary_record.Stamp, err = t.get_stamp(stub, beneficiary_key)
+	if err != nil {
+		return err
+	}
+	beneficiary_record.touch(now, tx_id)
+	bytes, err := json.Marshal(beneficiary_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Beneficiary record #####")
+	}
+	err = stub.PutState(beneficiary_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Beneficiary #####")
+	}
+	return nil
+}
+
+//
+// legacy_shares converts the fixed beneficiary fields of old records, in LEGACY_BENEFICIARIES order
+//
+func legacy_shares(percents [5]Ratio, amounts [5]Money) []BeneficiaryShare {
+	var shares	[]BeneficiaryShare
+
+	for i, code := range LEGACY_BENEFICIARIES {
+		if percents[i] == 0 && amounts[i] == 0 {
+			continue
+		}
+		shares = append(shares, BeneficiaryShare{Code: code, Percent: percents[i], Amount: amounts[i]})
+	}
+	return shares
+}
+
+//
+// Receivable: normalize converts a record written before beneficiaries
+//
+func (r *Receivable) normalize() {
+	if len(r.Beneficiaries) == 0 {
+		r.Beneficiaries = legacy_shares(
+			[5]Ratio{r.AMCPercent, r.GCCPercent, r.GMCPercent, r.RBBCPercent, r.CICPercent},
+			[5]Money{r.AMCAmount, r.GCCAmount, r.GMCAmount, r.RBBCAmount, r.CICAmount})
+	}
+	r.AMCPercent, r.GCCPercent, r.GMCPercent, r.RBBCPercent, r.CICPercent = 0, 0, 0, 0, 0
+	r.AMCAmount, r.GCCAmount, r.GMCAmount, r.RBBCAmount, r.CICAmount = 0, 0, 0, 0, 0
+}
+
+//
+// make_project builds a project from its arguments; with KeepOthers the shares of
+// current_shares not given in the arguments are kept
+//
+func (t *SimpleChaincode) make_project(stub LedgerStub, project_args ProjectArgs, current_shares []BeneficiaryShare) (Project, error) {
+	var project_record	Project
+
+	// String to Money
+	project_record = Project {
+		ProjectId:	project_args.ProjectId,
+		ProjectName:	project_args.ProjectName,
+		InvestType:	project_args.InvestType,
+		Status:		PROJECT_STATUS_DRAFT,
+		Confirmed:	false,
+	}
+	v, err := t.get_validator(stub)
+	if err != nil {
+		return project_record, err
+	}
+	project_record.InvestAmount = v.amount("invest_amount", project_args.InvestAmount)
+	project_record.Beneficiaries = t.make_beneficiary_shares(stub, v, project_args.Beneficiaries, false)
+	if project_args.KeepOthers {
+		given := map[string]bool{}
+		for _, args := range project_args.Beneficiaries {
+			given[args.Code] = true
+		}
+		for _, share := range current_shares {
+			if !given[share.Code] {
+				project_record.Beneficiaries = append(project_record.Beneficiaries, share)
+			}
+		}
+	}
+	project_record.Participants = t.make_participants(stub, v, project_args.Participants)
+	config, err := t.get_consistency_config(stub)
+	if err != nil {
+		return project_record, err
+	}
+	project_record.check_consistency(v, config.Rules, config.Tolerance, config.PercentTolerance)
+	return project_record, v.error()
+}
+
+//
+// load_project
+//
+func (t *SimpleChaincode) load_project(stub LedgerStub, project_id string) (Project, error) {
+	var project_record	Project
+
+	project_asbytes, err := stub.GetState("project/" + project_id)
+	if err != nil {
+		return project_record, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if project_asbytes == nil {
+		return project_record, errors.New("##### OpeEx1: project_id: " + project_id + " was not found #####")
+	}
+	err = json.Unmarshal(project_asbytes, &project_record)
+	if err != nil {
+		return project_record, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+	}
+	project_record.normalize()
+	return project_record, nil
+}
+
+//
+// save_project writes the project with the next version and keeps a copy of that version
+//
+func (t *SimpleChaincode) save_project(stub LedgerStub, project_record Project, function string, user string, now time.Time, tx_id string) error {
+	var err		error
+	var stored	Project
+
+	project_key := "project/" + project_record.ProjectId
+	if project_record.CreatedAt == "" {
+		project_record.Stamp, err = t.get_stamp(stub, project_key)
+		if err != nil {
+			return err
+		}
+	}
+	stored_asbytes, err := stub.GetState(project_key)
+	if err != nil {
+		return errors.New("##### OpeEx1: Failed to get state for project_id: " + project_record.ProjectId + " #####")
+	}
+	if stored_asbytes != nil {
+		err = json.Unmarshal(stored_asbytes, &stored)
+		if err != nil {
+			return errors.New("##### OpeEx1: Error unmarshalling data " + string(stored_asbytes) + " #####")
+		}
+		// A record written before versions existed is kept as version 0, by whom and
+		// in which function is not known
+		if stored.Version == 0 {
+			stored.normalize()
+			err = t.put_project_version(stub, ProjectVersion {
+				ProjectId:	stored.ProjectId,
+				Version:	0,
+				TxId:		stored.CreatedTx,
+				Timestamp:	stored.UpdatedAt,
+				Project:	stored,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	project_record.Version = stored.Version + 1
+	project_record.touch(now, tx_id)
+	bytes, err := json.Marshal(project_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error on creating new Project record #####")
+	}
+	err = stub.PutState(project_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Project #####")
+	}
+
+	err = t.put_project_version(stub, ProjectVersion {
+		ProjectId:	project_record.ProjectId,
+		Version:	project_record.Version,
+		TxId:		tx_id,
+		Function:	function,
+		Caller:		user,
+		Timestamp:	format_time(now),
+		Project:	project_record,
+	})
+	if err != nil {
+		return err
+	}
+	return t.sync_reservation(stub, project_record, now, tx_id)
+}
+
+//
+// put_project_version
+//
+func (t *SimpleChaincode) put_project_version(stub LedgerStub, version_record ProjectVersion) error {
+	bytes, err := json.Marshal(version_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error on creating new ProjectVersion record #####")
+	}
+	err = stub.PutState(t.project_version_key(version_record.ProjectId, version_record.Version), []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for ProjectVersion #####")
+	}
+	return nil
+}
+
+//
+// get_reservation_config
+//
+func (t *SimpleChaincode) get_reservation_config(stub LedgerStub) (ReservationConfig, error) {
+	var config	ReservationConfig
+
+	config_asbytes, err := stub.GetState("config/reservation")
+	if err != nil {
+		return config, errors.New("##### OpeEx1: Failed to get state for config/reservation #####")
+	}
+	if config_asbytes != nil {
+		err = json.Unmarshal(config_asbytes, &config)
+		if err != nil {
+			return config, errors.New("##### OpeEx1: Error unmarshalling data " + string(config_asbytes) + " #####")
+		}
+	}
+	return config, nil
+}
+
+//
+// get_reservation returns the reservation of a project, nil if it has none
+//
+func (t *SimpleChaincode) get_reservation(stub LedgerStub, project_id string) (*Reservation, error) {
+	var reservation	Reservation
+
+	reservation_asbytes, err := stub.GetState("reservation/" + project_id)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for reservation of project_id: " + project_id + " #####")
+	}
+	if reservation_asbytes == nil {
+		return nil, nil
+	}
+	err = json.Unmarshal(reservation_asbytes, &reservation)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(reservation_asbytes) + " #####")
+	}
+	return &reservation, nil
+}
+
+//
+// put_reservation
+//
+func (t *SimpleChaincode) put_reservation(stub LedgerStub, reservation Reservation, now time.Time, tx_id string) error {
+	var err		error
+
+	reservation_key := "reservation/" + reservation.ProjectId
+	reservation.Stamp, err = t.get_stamp(stub, reservation_key)
+	if err != nil {
+		return err
+	}
+	reservation.touch(now, tx_id)
+	bytes, err := json.Marshal(reservation)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Reservation record #####")
+	}
+	err = stub.PutState(reservation_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Reservation #####")
+	}
+	return nil
+}
+
+//
+// sync_reservation makes the reservation of a project, if it has one, hold the
+// amounts of the participants not yet confirmed, nothing once closed or cancelled
+//
+func (t *SimpleChaincode) sync_reservation(stub LedgerStub, project_record Project, now time.Time, tx_id string) error {
+	reservation, err := t.get_reservation(stub, project_record.ProjectId)
+	if err != nil || reservation == nil {
+		return err
+	}
+	var held	Money
+	if project_record.Status != PROJECT_STATUS_CLOSED && project_record.Status != PROJECT_STATUS_CANCELLED {
+		for _, participant := range project_record.Participants {
+			if !participant.Confirmed {
+				held, err = held.add(participant.Amount)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	delta, err := held.sub(reservation.Amount)
+	if err != nil {
+		return err
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	amount_record, err := t.get_amount(stub, reservation.Entity)
+	if err != nil {
+		return err
+	}
+	available, err := amount_record.available()
+	if err != nil {
+		return err
+	}
+	if delta > 0 && available < delta {
+		return errors.New(fmt.Sprintf("##### OpeEx1: %s cannot reserve %s for project_id: %s, available %s #####",
+			reservation.Entity, delta, project_record.ProjectId, available))
+	}
+	amount_record.Reserved, err = amount_record.Reserved.add(delta)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("sync_reservation: %s holds %s for project_id: %s, %s in all\n", reservation.Entity, held, project_record.ProjectId, amount_record.Reserved)
+	err = t.put_amount(stub, amount_record, now, tx_id)
+	if err != nil {
+		return err
+	}
+	reservation.Amount = held
+	return t.put_reservation(stub, *reservation, now, tx_id)
+}
+
+//
+// project_version_key
+//
+func (t *SimpleChaincode) project_version_key(project_id string, version uint32) string {
+	return fmt.Sprintf("projectver/%s/%08d", project_id, version)
+}
+
+//
+// get_project_history returns every version of a project kept since versions existed,
+// from version 0 for a project written before
+//
+func (t *SimpleChaincode) get_project_history(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into get_project_history")
+	var versions	[]ProjectVersion
+
+	iter, err := stub.RangeQueryState("projectver/" + project_id + "/", "projectver/" + project_id + "/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, version_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var version_record ProjectVersion
+		err = json.Unmarshal(version_asbytes, &version_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(version_asbytes) + " #####")
+		}
+		fmt.Printf("Query (get_project_history): version %d by %s (%s) in %s\n",
+			version_record.Version, version_record.Caller, version_record.Function, version_record.TxId)
+		versions = append(versions, version_record)
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("##### OpeEx1: No version was found for project_id: " + project_id + " #####")
+	}
+
+	bytes, err := json.Marshal(versions)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_project_history")
+	return []byte(bytes), nil
+}
+
+//
+// get_project_at_version
+//
+func (t *SimpleChaincode) get_project_at_version(stub LedgerStub, project_id string, version uint32) ([]byte, error) {
+	fmt.Println("Entering into get_project_at_version")
+
+	version_asbytes, err := stub.GetState(t.project_version_key(project_id, version))
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if version_asbytes == nil {
+		return nil, errors.New("##### OpeEx1: Version " + strconv.FormatUint(uint64(version), 10) + " of project_id: " + project_id + " was not found #####")
+	}
+	fmt.Println("Returning from get_project_at_version")
+	return version_asbytes, nil
+}
+
+//
+// amend_project carries confirmations over from current_record to project_record,
+// posts the differences in confirmed amounts between the issuer and each entity
+// and records them as an amendment
+//
+func (t *SimpleChaincode) amend_project(stub LedgerStub, current_record Project, project_record *Project, function string, user string, now time.Time, tx_id string) error {
+	issuer, err := t.get_issuer(stub)
+	if err != nil {
+		return err
+	}
+	amendments, err := t.get_amendments(stub, project_record.ProjectId)
+	if err != nil {
+		return err
+	}
+	amendment_record := Amendment {
+		ProjectId:	project_record.ProjectId,
+		Sequence:	uint32(len(amendments) + 1),
+		AmendedBy:	user,
+		OldStatus:	current_record.Status,
+	}
+
+	// Entities of the current record, then entities added by the update
+	for _, old := range current_record.Participants {
+		change := AmendmentChange{Entity: old.Entity, OldAmount: old.Amount}
+		participant, err := project_record.participant(old.Entity)
+		if err == nil {
+			change.NewAmount = participant.Amount
+			participant.Confirmed, participant.ConfirmedBy, participant.ConfirmedAt, participant.ConfirmedTx =
+				old.Confirmed, old.ConfirmedBy, old.ConfirmedAt, old.ConfirmedTx
+		}
+		if old.Confirmed {
+			change.Posted, err = change.NewAmount.sub(change.OldAmount)
+			if err != nil {
+				return err
+			}
+		}
+		if change.OldAmount != change.NewAmount {
+			amendment_record.Changes = append(amendment_record.Changes, change)
+		}
+	}
+	for _, participant := range project_record.Participants {
+		_, err := current_record.participant(participant.Entity)
+		if err != nil {
+			amendment_record.Changes = append(amendment_record.Changes, AmendmentChange{Entity: participant.Entity, NewAmount: participant.Amount})
+		}
+	}
+
+	for _, change := range amendment_record.Changes {
+		if change.Posted == 0 {
+			continue
+		}
+		fmt.Printf("amend_project: %s moves from %s to %s\n", change.Posted, issuer, change.Entity)
+		err = t.post(stub, function, project_record.ProjectId, change.Entity, issuer, change.Posted, now, tx_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// An amendment is not a transition, the status follows the confirmations which remain;
+	// a project under renegotiation stays so until it is submitted again
+	if project_record.Status != PROJECT_STATUS_RENEGOTIATION {
+		project_record.Status = project_record.confirmation_status()
+	}
+	project_record.Confirmed = project_record.Status == PROJECT_STATUS_CONFIRMED
+	amendment_record.NewStatus = project_record.Status
+
+	amendment_record.touch(now, tx_id)
+	bytes, err := json.Marshal(amendment_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Amendment record #####")
+	}
+	err = stub.PutState(fmt.Sprintf("amendment/%s/%04d", amendment_record.ProjectId, amendment_record.Sequence), []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Amendment #####")
+	}
+	return nil
+}
+
+//
+// get_all_transfer returns the transfers from or to entity in journal order, every transfer if entity is ""
+//
+func (t *SimpleChaincode) get_all_transfer(stub LedgerStub, entity string) ([]Transfer, error) {
+	transfers := []Transfer{}
+
+	iter, err := stub.RangeQueryState("transfer/", "transfer/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, transfer_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var transfer_record Transfer
+		err = json.Unmarshal(transfer_asbytes, &transfer_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(transfer_asbytes) + " #####")
+		}
+		if entity != "" && transfer_record.From != entity && transfer_record.To != entity {
+			continue
+		}
+		transfers = append(transfers, transfer_record)
+	}
+	return transfers, nil
+}
+
+//
+// get_amendments returns every amendment of a project in sequence order
+//
+func (t *SimpleChaincode) get_amendments(stub LedgerStub, project_id string) ([]Amendment, error) {
+	var amendments	[]Amendment
+
+	iter, err := stub.RangeQueryState("amendment/" + project_id + "/", "amendment/" + project_id + "/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, amendment_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var amendment_record Amendment
+		err = json.Unmarshal(amendment_asbytes, &amendment_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(amendment_asbytes) + " #####")
+		}
+		amendments = append(amendments, amendment_record)
+	}
+	return amendments, nil
+}
+
+//
+// slot_participants converts three-slot fields to participants; a slot left
+// empty, or confirmed with no amount, did not participate
+//
+func slot_participants(slots [3]Participant) []Participant {
+	var participants	[]Participant
+
+	for _, slot := range slots {
+		if slot.Amount == 0 && (slot.Confirmed || (slot.Dept == "" && slot.Team == "" && slot.Person == "")) {
+			continue
+		}
+		participants = append(participants, slot)
+	}
+	return participants
+}
+
+//
+// Project: normalize converts a record written before beneficiaries, participants or statuses
+//
+func (p *Project) normalize() {
+	if len(p.Beneficiaries) == 0 {
+		p.Beneficiaries = legacy_shares(
+			[5]Ratio{p.AMCPercent, p.GCCPercent, p.GMCPercent, p.RBBCPercent, p.CICPercent},
+			[5]Money{})
+	}
+	p.AMCPercent, p.GCCPercent, p.GMCPercent, p.RBBCPercent, p.CICPercent = 0, 0, 0, 0, 0
+	if len(p.Participants) == 0 {
+		p.Participants = slot_participants([3]Participant {
+			{ Entity: "BK", Dept: p.BKDept, Team: p.BKTeam, Person: p.BKPerson, Amount: p.BKAmount, Confirmed: p.BKConfirmed },
+			{ Entity: "SC", Dept: p.SCDept, Team: p.SCTeam, Person: p.SCPerson, Amount: p.SCAmount, Confirmed: p.SCConfirmed },
+			{ Entity: "TB", Dept: p.TBDept, Team: p.TBTeam, Person: p.TBPerson, Amount: p.TBAmount, Confirmed: p.TBConfirmed },
+		})
+	}
+	p.BKDept, p.BKTeam, p.BKPerson, p.BKAmount, p.BKConfirmed = "", "", "", 0, false
+	p.SCDept, p.SCTeam, p.SCPerson, p.SCAmount, p.SCConfirmed = "", "", "", 0, false
+	p.TBDept, p.TBTeam, p.TBPerson, p.TBAmount, p.TBConfirmed = "", "", "", 0, false
+	if p.Status == "" {
+		// Records written before statuses were open for confirmation from registration
+		p.Status = PROJECT_STATUS_SUBMITTED
+		if p.Confirmed {
+			p.Status = PROJECT_STATUS_CONFIRMED
+		} else {
+			for _, participant := range p.Participants {
+				if participant.Confirmed {
+					p.Status = PROJECT_STATUS_PARTIALLY_CONFIRMED
+				}
+			}
+		}
+	}
+}
+
+//
+// Project: participant
+//
+func (p *Project) participant(entity string) (*Participant, error) {
+	for i := range p.Participants {
+		if p.Participants[i].Entity == entity {
+			return &p.Participants[i], nil
+		}
+	}
+	return nil, errors.New("##### OpeEx1: project_id: " + p.ProjectId + " has no allocation for entity: " + entity + " #####")
+}
+
+//
+// Project: all_confirmed
+//
+func (p *Project) all_confirmed() bool {
+	for _, participant := range p.Participants {
+		if !participant.Confirmed {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Project: has_confirmations
+//
+func (p *Project) has_confirmations() bool {
+	for _, participant := range p.Participants {
+		if participant.Confirmed {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Project: confirmation_status derives submitted, partially_confirmed or confirmed from the participants
+//
+func (p *Project) confirmation_status() string {
+	if !p.has_confirmations() {
+		return PROJECT_STATUS_SUBMITTED
+	} else if p.all_confirmed() {
+		return PROJECT_STATUS_CONFIRMED
+	}
+	return PROJECT_STATUS_PARTIALLY_CONFIRMED
+}
+
+//
+// Project: editable reports whether kind, a field name of PROJECT_EDITABLE, may change
+//
+func (p *Project) editable(kind string) bool {
+	if (kind == "invest_amount" || kind == "participant.amount") && p.has_confirmations() {
+		return false
+	}
+	for _, editable := range PROJECT_EDITABLE[p.Status] {
+		if editable == kind {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Project: patch changes one field, reporting to v a field which is unknown or may not change
+//
+func (p *Project) patch(v *Validator, field string, value string) {
+	path := strings.Split(field, ".")
+	kind := field
+	if len(path) == 3 {
+		kind = path[0] + "." + path[2]
+	}
+	if !p.editable(kind) {
+		// Every field is editable in draft
+		known := false
+		for _, editable := range PROJECT_EDITABLE[PROJECT_STATUS_DRAFT] {
+			known = known || editable == kind
+		}
+		if !known {
+			v.fail(field, value, "is not a field of project")
+		} else {
+			v.fail(field, value, "may not change while the project is " + p.Status)
+		}
+		return
+	}
+
+	if kind == "project_name" {
+		p.ProjectName = value
+	} else if kind == "invest_type" {
+		p.InvestType = value
+	} else if kind == "invest_amount" {
+		p.InvestAmount = v.amount(field, value)
+	} else if path[0] == "participant" {
+		participant, err := p.participant(path[1])
+		if err != nil {
+			v.fail(field, value, "has no allocation for entity " + path[1])
+			return
+		}
+		if path[2] == "dept" {
+			participant.Dept = value
+		} else if path[2] == "team" {
+			participant.Team = value
+		} else if path[2] == "person" {
+			participant.Person = value
+		} else {
+			amount := v.amount(field, value)
+			if amount != participant.Amount {
+				participant.Rejected, participant.Reason = false, ""
+			}
+			participant.Amount = amount
+		}
+	} else {
+		for i := range p.Beneficiaries {
+			if p.Beneficiaries[i].Code == path[1] {
+				p.Beneficiaries[i].Percent = v.percent(field, value)
+				return
+			}
+		}
+		v.fail(field, value, "has no share for beneficiary " + path[1])
+	}
+}
+
+//
+// Project: keep_rejections carries Rejected and Reason over from current_record
+// for each entity whose amount has not changed
+//
+func (p *Project) keep_rejections(current_record Project) {
+	for i := range p.Participants {
+		old, err := current_record.participant(p.Participants[i].Entity)
+		if err == nil && old.Amount == p.Participants[i].Amount {
+			p.Participants[i].Rejected, p.Participants[i].Reason = old.Rejected, old.Reason
+		}
+	}
+}
+
+//
+// Project: move_to changes the status if PROJECT_TRANSITIONS allows it
+//
+func (p *Project) move_to(status string) error {
+	for _, next := range PROJECT_TRANSITIONS[p.Status] {
+		if next == status {
+			p.Status = status
+			p.Confirmed = status == PROJECT_STATUS_CONFIRMED || status == PROJECT_STATUS_CLOSED
+			return nil
+		}
+	}
+	return errors.New("##### OpeEx1: project_id: " + p.ProjectId + " cannot move from " + p.Status + " to " + status + " #####")
+}
+
+//
+// Distribution: normalize converts a record written before participants
+//
+func (d *Distribution) normalize() {
+	if len(d.Participants) == 0 {
+		d.Participants = slot_participants([3]Participant {
+			{ Entity: "BK", Dept: d.BKDept, Team: d.BKTeam, Person: d.BKPerson, Amount: d.BKAmount },
+			{ Entity: "SC", Dept: d.SCDept, Team: d.SCTeam, Person: d.SCPerson, Amount: d.SCAmount },
+			{ Entity: "TB", Dept: d.TBDept, Team: d.TBTeam, Person: d.TBPerson, Amount: d.TBAmount },
+		})
+	}
+	d.BKDept, d.BKTeam, d.BKPerson, d.BKAmount = "", "", "", 0
+	d.SCDept, d.SCTeam, d.SCPerson, d.SCAmount = "", "", "", 0
+	d.TBDept, d.TBTeam, d.TBPerson, d.TBAmount = "", "", "", 0
+}
+
+//
+// get_issue
+//
+func (t *SimpleChaincode) get_issue(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into get_issue")
+	var err			error
+	var issue_summary	IssueSummary
+
+	// Get the state from the ledger
+	issue_summary.ProjectId = project_id
+	issue_summary.Currency = REPORTING_CURRENCY
+	issue_summary.Tranches, err = t.get_issue_tranches(stub, project_id)
+	if err != nil {
+		return nil, err
+	}
+	if len(issue_summary.Tranches) == 0 {
+		return nil, errors.New("##### OpeEx1: No issue was found for project_id: " + project_id + " #####")
+	}
+	for _, issue_record := range issue_summary.Tranches {
+		issue_summary.TotalAmount, err = issue_summary.TotalAmount.add(issue_record.ReportingAmount)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Query (get_issue): tranche %d: %s %s (rate %s) in FY%d\n",
+			issue_record.Tranche, issue_record.IssueAmount, issue_record.Currency, issue_record.IssueRate, issue_record.IssueYear)
+	}
+	fmt.Printf("Query (get_issue): project_id = %s\n",	project_id)
+	fmt.Printf("Query (get_issue): total_amount = %s\n",	issue_summary.TotalAmount)
+
+	bytes, err := json.Marshal(issue_summary)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_issue")
+	return []byte(bytes), nil
+}
+
+//
+// get_project
+//
+func (t *SimpleChaincode) get_project(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into get_project")
+
+	// Get the state from the ledger
+	project_record, err := t.load_project(stub, project_id)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Query (get_project): project_id = %s\n",	project_id)
+	fmt.Printf("Query (get_project): project_name = %s\n",	project_record.ProjectName)
+	fmt.Printf("Query (get_project): status = %s\n",		project_record.Status)
+	fmt.Printf("Query (get_project): invest_type = %s\n",	project_record.InvestType)
+	fmt.Printf("Query (get_project): invest_amount = %s\n",	project_record.InvestAmount)
+	for _, share := range project_record.Beneficiaries {
+		fmt.Printf("Query (get_project): %s: percent = %s\n",	share.Code, share.Percent)
+	}
+	for _, participant := range project_record.Participants {
+		fmt.Printf("Query (get_project): %s: %s / %s / %s, amount = %s, confirmed = %t\n",
+			participant.Entity, participant.Dept, participant.Team, participant.Person, participant.Amount, participant.Confirmed)
+	}
+
+	bytes, err := json.Marshal(project_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_project")
+	return []byte(bytes), nil
+}
+
+//
+// get_distribution
+//
+func (t *SimpleChaincode) get_distribution(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into get_distribution")
+	var err				error
+	var distribution_record		Distribution
+
+	// Get the state from the ledger
+	distribution_key := "distribution/" + project_id
+	distribution_asbytes, err := stub.GetState(distribution_key)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if distribution_asbytes == nil {
+		return nil, errors.New("##### OpeEx1: distribution for project_id: " + project_id + " was not found #####")
+	}
+	err = json.Unmarshal(distribution_asbytes, &distribution_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(distribution_asbytes) + " #####")
+	}
+	distribution_record.normalize()
+	fmt.Printf("Query (get_distribution): project_id = %s\n",	project_id)
+	fmt.Printf("Query (get_distribution): currency = %s\n",		distribution_record.Currency)
+	fmt.Printf("Query (get_distribution): issue_rate = %s\n",	distribution_record.IssueRate)
+	fmt.Printf("Query (get_distribution): issue_amount = %s\n",	distribution_record.IssueAmount)
+	fmt.Printf("Query (get_distribution): issuer = %s\n",		distribution_record.Issuer)
+	fmt.Printf("Query (get_distribution): issue_year = %d\n",	distribution_record.IssueYear)
+	for _, participant := range distribution_record.Participants {
+		fmt.Printf("Query (get_distribution): %s: %s / %s / %s, amount = %s\n",
+			participant.Entity, participant.Dept, participant.Team, participant.Person, participant.Amount)
+	}
+
+	bytes, err := json.Marshal(distribution_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_distribution")
+	return []byte(bytes), nil
+}
+
+//
+// get_receivable
+//
+func (t *SimpleChaincode) get_receivable(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into get_receivable")
+	var err			error
+	var receivable_record	Receivable
+
+	// Get the state from the ledger
+	receivable_key := "receivable/" + project_id
+	receivable_asbytes, err := stub.GetState(receivable_key)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	}
+	if receivable_asbytes == nil {
+		return nil, errors.New("##### OpeEx1: receivable for project_id: " + project_id + " was not found #####")
+	}
+	err = json.Unmarshal(receivable_asbytes, &receivable_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(receivable_asbytes) + " #####")
+	}
+	receivable_record.normalize()
+	fmt.Printf("Query (get_receivable): project_id = %s\n",		project_id)
+	fmt.Printf("Query (get_receivable): currency = %s\n",		receivable_record.Currency)
+	for _, share := range receivable_record.Beneficiaries {
+		fmt.Printf("Query (get_receivable): %s: percent = %s, amount = %s\n",	share.Code, share.Percent, share.Amount)
+	}
+
+	bytes, err := json.Marshal(receivable_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_receivable")
+	return []byte(bytes), nil
+}
+
+//
+// get_current_amount
+//
+func (t *SimpleChaincode) get_current_amount(stub LedgerStub, entity string) ([]byte, error) {
+	fmt.Println("Entering into get_current_amount")
+	var err			error
+	var amount_record	Amount
+
+	// Get the state from the ledger
+	amount_asbytes, err := stub.GetState(entity)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for entity: " + entity + " #####")
+	}
+
+	err = json.Unmarshal(amount_asbytes, &amount_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(amount_asbytes) + " #####")
+	}
+	fmt.Printf("Query (get_current_amount): entity = %s\n",	entity)
+	fmt.Printf("Query (get_current_amount): amount = %s\n",	amount_record.Amount)
+
+	bytes, err := json.Marshal(amount_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_current_amount")
+	return []byte(bytes), nil
+}
+
+//
+// get_all_amount returns the current amount of every registered entity
+//
+func (t *SimpleChaincode) get_all_amount(stub LedgerStub) ([]byte, error) {
+	fmt.Println("Entering into get_all_amount")
+	var amount_set		AmountSet
+
+	entities, err := t.get_all_entities(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity_record := range entities {
+		amount_record, err := t.get_amount(stub, entity_record.Code)
+		if err != nil {
+			return nil, err
+		}
+		amount_set.Amounts = append(amount_set.Amounts, amount_record)
+	}
+	bytes, err := json.Marshal(amount_set.Amounts)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_all_amount")
+	return []byte(bytes), nil
+}
+
+//
+// get_ranking
+//
+func (t *SimpleChaincode) get_ranking(stub LedgerStub, ranking_year uint64, ranking_person string) ([]byte, error) {
+	fmt.Println("Entering into get_ranking")
+	var err			error
+	var ranking_record	Ranking
+	
+	// Get the state from the ledger
+	year_str := strconv.FormatUint(ranking_year, 10)
+	ranking_key := "ranking/" + year_str + "/" + ranking_person
+	ranking_asbytes, err := stub.GetState(ranking_key)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for ranking_key: " + ranking_key + " #####")
+	}
+	err = json.Unmarshal(ranking_asbytes, &ranking_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(ranking_asbytes) + " #####")
+	}
+	fmt.Printf("Query (get_ranking): Year = %d\n",		ranking_record.Year)
+	fmt.Printf("Query (get_ranking): Rank = %d\n",		ranking_record.Rank)
+	fmt.Printf("Query (get_ranking): Person = %s\n",	ranking_record.Person)
+	fmt.Printf("Query (get_ranking): URL = %s\n",		ranking_record.URL)	
+
+	bytes, err := json.Marshal(ranking_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning Ranking record #####")
+	}
+	fmt.Println("Returning from get_ranking")
+	return []byte(bytes), nil
+}
+
+//
+// get_all_project
+//
+func (t *SimpleChaincode) get_all_project(stub LedgerStub, status string) ([]byte, error) {
+	fmt.Println("Entering into get_all_project")
+	var err			error
+	var project_set		ProjectSet
+
+	iter, err := stub.RangeQueryState("project/", "project/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, project_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var project_record Project
+		err = json.Unmarshal(project_asbytes, &project_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+		}
+		project_record.normalize()
+		if status != "" && project_record.Status != status {
+			continue
+		}
+		project_set.Projects = append(project_set.Projects, project_record)
+	}
+	bytes, err := json.Marshal(project_set.Projects)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_all_project")
+	return []byte(bytes), nil
+}
+
+//
+// validate_project reports the projects which break any consistency rule
+//
+func (t *SimpleChaincode) validate_project(stub LedgerStub, project_id string) ([]byte, error) {
+	fmt.Println("Entering into validate_project")
+	var projects		[]Project
+	var validations		[]ProjectValidation
+
+	config, err := t.get_consistency_config(stub)
+	if err != nil {
+		return nil, err
+	}
+	if project_id != "" {
+		project_record, err := t.load_project(stub, project_id)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project_record)
+	} else {
+		iter, err := stub.RangeQueryState("project/", "project/~")
+		if err != nil {
+			return nil, errors.New("Unable to start the iterator")
+		}
+		defer iter.Close()
+		for iter.HasNext() {
+			_, project_asbytes, iterErr := iter.Next()
+			if iterErr != nil {
+				return nil, errors.New("keys operation failed. Error accessing next state")
+			}
+			var project_record Project
+			err = json.Unmarshal(project_asbytes, &project_record)
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+			}
+			project_record.normalize()
+			projects = append(projects, project_record)
+		}
+	}
+	for _, project_record := range projects {
+		v := &Validator{Mode: VALIDATION_STRICT}
+		project_record.check_consistency(v, CONSISTENCY_RULES, config.Tolerance, config.PercentTolerance)
+		if len(v.Errors) == 0 {
+			continue
+		}
+		fmt.Printf("Query (validate_project): project_id: %s breaks %d rules\n", project_record.ProjectId, len(v.Errors))
+		validations = append(validations, ProjectValidation {
+			ProjectId:	project_record.ProjectId,
+			Status:		project_record.Status,
+			Errors:		v.Errors,
+		})
+	}
+
+	bytes, err := json.Marshal(validations)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from validate_project")
+	return []byte(bytes), nil
+}
+
+//
+// get_amount_history returns the movements of an entity between from and to,
+// every movement if both are zero
+//
+func (t *SimpleChaincode) get_amount_history(stub LedgerStub, entity string, from time.Time, to time.Time) ([]byte, error) {
+	fmt.Println("Entering into get_amount_history")
+	var history	AmountHistory
+
+	history.Entity = entity
+	history.Currency = REPORTING_CURRENCY
+	if !from.IsZero() {
+		history.From = format_time(from)
+		history.To = format_time(to)
+	}
+	entries, err := t.get_account_journal(stub, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The running balance counts every movement, also those outside the range; entries
+	// follow the journal sequence, their timestamps need not be in order
+	var balance	Money
+	for _, entry := range entries {
+		movement := AmountMovement {
+			Sequence:	entry.Sequence,
+			TxId:		entry.TxId,
+			Timestamp:	entry.CreatedAt,
+			Function:	entry.Function,
+			ProjectId:	entry.ProjectId,
+		}
+		for _, line := range entry.Lines {
+			if line.Account == entity {
+				movement.Debit, err = movement.Debit.add(line.Debit)
+				if err != nil {
+					return nil, err
+				}
+				movement.Credit, err = movement.Credit.add(line.Credit)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				movement.Counterparty = line.Account
+			}
+		}
+		balance, err = movement.apply(balance)
+		if err != nil {
+			return nil, err
+		}
+		movement.Balance = balance
+
+		if !from.IsZero() {
+			timestamp, err := time.Parse(time.RFC3339, entry.CreatedAt)
+			if err != nil {
+				return nil, errors.New("##### OpeEx1: Error parsing timestamp of journal entry " + strconv.FormatUint(entry.Sequence, 10) + " #####")
+			}
+			if timestamp.Before(from) {
+				history.OpeningBalance, err = movement.apply(history.OpeningBalance)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if !timestamp.Before(to) {
+				continue
+			}
+		}
+		history.Movements = append(history.Movements, movement)
+	}
+	history.ClosingBalance = history.OpeningBalance
+	for _, movement := range history.Movements {
+		history.ClosingBalance, err = movement.apply(history.ClosingBalance)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Printf("Query (get_amount_history): %s: %d movements, %s -> %s\n",
+		entity, len(history.Movements), history.OpeningBalance, history.ClosingBalance)
+
+	bytes, err := json.Marshal(history)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_amount_history")
+	return []byte(bytes), nil
+}
+
+//
+// get_last_closed_year returns the latest year closed by close_fiscal_year, 0 if none
+//
+func (t *SimpleChaincode) get_last_closed_year(stub LedgerStub) (uint16, error) {
+	var last	uint16
+
+	iter, err := stub.RangeQueryState("period/", "period/~")
+	if err != nil {
+		return 0, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, close_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return 0, errors.New("keys operation failed. Error accessing next state")
+		}
+		var close_record FiscalClose
+		err = json.Unmarshal(close_asbytes, &close_record)
+		if err != nil {
+			return 0, errors.New("##### OpeEx1: Error unmarshalling data " + string(close_asbytes) + " #####")
+		}
+		if close_record.Year > last {
+			last = close_record.Year
+		}
+	}
+	return last, nil
+}
+
+//
+// check_period_open fails if the fiscal year of now has been closed
+//
+func (t *SimpleChaincode) check_period_open(stub LedgerStub, now time.Time) error {
+	calendar, err := t.get_fiscal_calendar(stub)
+	if err != nil {
+		return err
+	}
+	year_str := strconv.FormatUint(uint64(calendar.fiscal_year(now)), 10)
+	close_asbytes, err := stub.GetState("period/" + year_str)
+	if err != nil {
+		return errors.New("##### OpeEx1: Failed to get state for period: " + year_str + " #####")
+	}
+	if close_asbytes != nil {
+		return errors.New("##### OpeEx1: FY" + year_str + " has been closed, nothing may be posted into it #####")
+	}
+	return nil
+}
+
+//
+// get_budget_source returns the account from which an entity uses its budget:
+// ACCOUNT_ISSUE for the issuer, the issuer for any other entity
+//
+func (t *SimpleChaincode) get_budget_source(stub LedgerStub, entity string) (string, error) {
+	issuer, err := t.get_issuer(stub)
+	if err != nil {
+		return "", err
+	}
+	if entity == issuer {
+		return ACCOUNT_ISSUE, nil
+	}
+	return issuer, nil
+}
+
+//
+// budget_key
+//
+func (t *SimpleChaincode) budget_key(entity string, year uint16) string {
+	return "budget/" + strconv.FormatUint(uint64(year), 10) + "/" + entity
+}
+
+//
+// get_budget returns the budget of an entity for a fiscal year, nil if it has none
+//
+func (t *SimpleChaincode) get_budget(stub LedgerStub, entity string, year uint16) (*Budget, error) {
+	var budget_record	Budget
+
+	budget_key := t.budget_key(entity, year)
+	budget_asbytes, err := stub.GetState(budget_key)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Failed to get state for " + budget_key + " #####")
+	}
+	if budget_asbytes == nil {
+		return nil, nil
+	}
+	err = json.Unmarshal(budget_asbytes, &budget_record)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(budget_asbytes) + " #####")
+	}
+	return &budget_record, nil
+}
+
+//
+// put_budget
+//
+func (t *SimpleChaincode) put_budget(stub LedgerStub, budget_record Budget, now time.Time, tx_id string) error {
+	var err error
+
+	budget_key := t.budget_key(budget_record.Entity, budget_record.Year)
+	budget_record.Stamp, err = t.get_stamp(stub, budget_key)
+	if err != nil {
+		return err
+	}
+	budget_record.touch(now, tx_id)
+	bytes, err := json.Marshal(budget_record)
+	if err != nil {
+		return errors.New("##### OpeEx1: Error creating new Budget record #####")
+	}
+	err = stub.PutState(budget_key, []byte(bytes))
+	if err != nil {
+		return errors.New("##### OpeEx1: Unable to put the state for Budget #####")
+	}
+	return nil
+}
+
+//
+// Budget: status
+//
+func (b *Budget) status() (BudgetStatus, error) {
+	var err error
+
+	status := BudgetStatus {
+		Entity:		b.Entity,
+		Year:		b.Year,
+		Currency:	REPORTING_CURRENCY,
+		Capped:		true,
+		Cap:		b.Cap,
+		Used:		b.Used,
+	}
+	status.Remaining, err = b.Cap.sub(b.Used)
+	return status, err
+}
+
+//
+// get_budget_status returns the use of the budget of an entity, kept on the budget
+// when it has one and otherwise worked out from the journal
+//
+func (t *SimpleChaincode) get_budget_status(stub LedgerStub, entity string, year uint16) (BudgetStatus, error) {
+	budget_record, err := t.get_budget(stub, entity, year)
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+	if budget_record != nil {
+		return budget_record.status()
+	}
+	used, err := t.count_budget_used(stub, entity, year)
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+	return BudgetStatus{ Entity: entity, Year: year, Currency: REPORTING_CURRENCY, Used: used }, nil
+}
+
+//
+// count_budget_used works out from the journal what an entity has used of its budget over a fiscal year
+//
+func (t *SimpleChaincode) count_budget_used(stub LedgerStub, entity string, year uint16) (Money, error) {
+	var used	Money
+
+	source, err := t.get_budget_source(stub, entity)
+	if err != nil {
+		return 0, err
+	}
+	calendar, err := t.get_fiscal_calendar(stub)
+	if err != nil {
+		return 0, err
+	}
+	start, end := calendar.year_range(year)
+	entries, err := t.get_account_journal(stub, entity)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		timestamp, err := time.Parse(time.RFC3339, entry.CreatedAt)
+		if err != nil {
+			return 0, errors.New("##### OpeEx1: Error parsing timestamp of journal entry " + strconv.FormatUint(entry.Sequence, 10) + " #####")
+		}
+		if timestamp.Before(start) || !timestamp.Before(end) {
+			continue
+		}
+		from_source := false
+		for _, line := range entry.Lines {
+			if line.Account == source {
+				from_source = true
+			}
+		}
+		if from_source {
+			net, err := entry.net(entity)
+			if err != nil {
+				return 0, err
+			}
+			used, err = used.add(net)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return used, nil
+}
+
+//
+// recount_budgets works out again the use of every budget, for when the fiscal calendar moves
+//
+func (t *SimpleChaincode) recount_budgets(stub LedgerStub, now time.Time, tx_id string) error {
+	var budgets	[]Budget
+
+	iter, err := stub.RangeQueryState("budget/", "budget/~")
+	if err != nil {
+		return errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, budget_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return errors.New("keys operation failed. Error accessing next state")
+		}
+		var budget_record Budget
+		err = json.Unmarshal(budget_asbytes, &budget_record)
+		if err != nil {
+			return errors.New("##### OpeEx1: Error unmarshalling data " + string(budget_asbytes) + " #####")
+		}
+		budgets = append(budgets, budget_record)
+	}
+	for _, budget_record := range budgets {
+		budget_record.Used, err = t.count_budget_used(stub, budget_record.Entity, budget_record.Year)
+		if err != nil {
+			return err
+		}
+		err = t.put_budget(stub, budget_record, now, tx_id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //
-// get username
+// check_budget fails if moving amount from credit to debit takes debit over its budget for the year of now
 //
-func (t *SimpleChaincode) get_username(stub *shim.ChaincodeStub) (string, error) {
-	fmt.Println("Entering into get_username")
-	bytes, err := stub.GetCallerCertificate();
+func (t *SimpleChaincode) check_budget(stub LedgerStub, debit string, credit string, amount Money, now time.Time) error {
+	if is_pseudo_account(debit) {
+		return nil
+	}
+	source, err := t.get_budget_source(stub, debit)
 	if err != nil {
-		return "", errors.New("Couldn't retrieve caller certificate")
+		return err
 	}
-	x509Cert, err := x509.ParseCertificate(bytes);		// Extract Certificate from result of GetCallerCertificate						
+	if credit != source {
+		return nil
+	}
+	calendar, err := t.get_fiscal_calendar(stub)
 	if err != nil {
-		return "", errors.New("Couldn't parse certificate")
+		return err
 	}
-															
-	fmt.Println("Returning from get_username")
-	return x509Cert.Subject.CommonName, nil
+	budget_record, err := t.get_budget(stub, debit, calendar.fiscal_year(now))
+	if err != nil || budget_record == nil {
+		return err
+	}
+	status, err := budget_record.status()
+	if err != nil {
+		return err
+	}
+	return status.check(amount)
 }
 
 //
-// get_issue
+// use_budget adds amount moved from credit to debit to the use of the budget of
+// debit, or takes it off that of credit for a reversal, in the year of now
 //
-func (t *SimpleChaincode) get_issue(stub *shim.ChaincodeStub, project_id string) ([]byte, error) {
-	fmt.Println("Entering into get_issue")
-	var err			error
-	var issue_record	Issue
-
-	// Get the state from the ledger
-	issue_key := "issue/" + project_id
-	issue_asbytes, err := stub.GetState(issue_key)
+func (t *SimpleChaincode) use_budget(stub LedgerStub, debit string, credit string, amount Money, now time.Time, tx_id string) error {
+	calendar, err := t.get_fiscal_calendar(stub)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+		return err
 	}
-	err = json.Unmarshal(issue_asbytes, &issue_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
+	year := calendar.fiscal_year(now)
+	for _, side := range []struct {
+		entity	string
+		from	string
+		amount	Money
+	}{
+		{debit, credit, amount},
+		{credit, debit, -amount},
+	} {
+		if is_pseudo_account(side.entity) {
+			continue
+		}
+		source, err := t.get_budget_source(stub, side.entity)
+		if err != nil {
+			return err
+		}
+		if side.from != source {
+			continue
+		}
+		budget_record, err := t.get_budget(stub, side.entity, year)
+		if err != nil {
+			return err
+		}
+		if budget_record == nil {
+			continue
+		}
+		budget_record.Used, err = budget_record.Used.add(side.amount)
+		if err != nil {
+			return err
+		}
+		err = t.put_budget(stub, *budget_record, now, tx_id)
+		if err != nil {
+			return err
+		}
 	}
-	fmt.Printf("Query (get_issue): project_id = %s\n",	project_id)
-	fmt.Printf("Query (get_issue): currency = %s\n",	issue_record.Currency)
-	fmt.Printf("Query (get_issue): issue_rate = %f\n",	issue_record.IssueRate)
-	fmt.Printf("Query (get_issue): issue_amount = %f\n",	issue_record.IssueAmount)
-	fmt.Printf("Query (get_issue): issuer = %s\n",		issue_record.Issuer)
-	fmt.Printf("Query (get_issue): issue_year = %d\n",	issue_record.IssueYear)
+	return nil
+}
 
-	bytes, err := json.Marshal(issue_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+//
+// BudgetStatus: check fails if amount is more than what remains of a capped budget
+//
+func (s BudgetStatus) check(amount Money) error {
+	if s.Capped && amount > s.Remaining {
+		return errors.New(fmt.Sprintf("##### OpeEx1: %s would go over its FY%d budget: cap %s, used %s, requested %s #####",
+			s.Entity, s.Year, s.Cap, s.Used, amount))
 	}
-	fmt.Println("Returning from get_issue")
-	return []byte(bytes), nil
+	return nil
 }
 
 //
-// get_project
+// get_balance_snapshot returns the snapshot of a closed year, or else works out the
+// balance of the year from the current balance and the journal; the opening is
+// carried forward from the year before once that is closed
 //
-func (t *SimpleChaincode) get_project(stub *shim.ChaincodeStub, project_id string) ([]byte, error) {
-	fmt.Println("Entering into get_project")
-	var err			error
-	var project_record	Project
+func (t *SimpleChaincode) get_balance_snapshot(stub LedgerStub, entity string, year uint16) (BalanceSnapshot, error) {
+	var snapshot	BalanceSnapshot
 
-	// Get the state from the ledger
-	project_key := "project/" + project_id
-	project_asbytes, err := stub.GetState(project_key)
+	year_str := strconv.FormatUint(uint64(year), 10)
+	snapshot_asbytes, err := stub.GetState("snapshot/" + year_str + "/" + entity)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+		return snapshot, errors.New("##### OpeEx1: Failed to get state for snapshot: " + year_str + "/" + entity + " #####")
 	}
-	if project_asbytes == nil {
-		return nil, errors.New("##### OpeEx1: project_id: " + project_id + " was not found #####")
+	if snapshot_asbytes != nil {
+		err = json.Unmarshal(snapshot_asbytes, &snapshot)
+		if err != nil {
+			return snapshot, errors.New("##### OpeEx1: Error unmarshalling data " + string(snapshot_asbytes) + " #####")
+		}
+		return snapshot, nil
 	}
-	err = json.Unmarshal(project_asbytes, &project_record)
+
+	amount_record, err := t.get_amount(stub, entity)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+		return snapshot, err
 	}
-	fmt.Printf("Query (get_project): project_id = %s\n",	project_id)
-	fmt.Printf("Query (get_project): project_name = %s\n",	project_record.ProjectName)
-	fmt.Printf("Query (get_project): confirmed = %t\n",	project_record.Confirmed)
-	fmt.Printf("Query (get_project): invest_type = %s\n",	project_record.InvestType)
-	fmt.Printf("Query (get_project): invest_amount = %f\n",	project_record.InvestAmount)
-	fmt.Printf("Query (get_project): amc_percent = %f\n",	project_record.AMCPercent)
-	fmt.Printf("Query (get_project): gcc_percent = %f\n",	project_record.GCCPercent)
-	fmt.Printf("Query (get_project): gmc_percent = %f\n",	project_record.GMCPercent)
-	fmt.Printf("Query (get_project): rbbc_percent = %f\n",	project_record.RBBCPercent)
-	fmt.Printf("Query (get_project): cic_percent = %f\n",	project_record.CICPercent)
-	fmt.Printf("Query (get_project): bk_dept = %s\n",	project_record.BKDept)
-	fmt.Printf("Query (get_project): bk_team = %s\n",	project_record.BKTeam)
-	fmt.Printf("Query (get_project): bk_person = %s\n",	project_record.BKPerson)
-	fmt.Printf("Query (get_project): bk_amount = %f\n",	project_record.BKAmount)
-	fmt.Printf("Query (get_project): bk_confirmed = %t\n",	project_record.BKConfirmed)
-	fmt.Printf("Query (get_project): sc_dept = %s\n",	project_record.SCDept)
-	fmt.Printf("Query (get_project): sc_team = %s\n",	project_record.SCTeam)
-	fmt.Printf("Query (get_project): sc_person = %s\n",	project_record.SCPerson)
-	fmt.Printf("Query (get_project): sc_amount = %f\n",	project_record.SCAmount)
-	fmt.Printf("Query (get_project): sc_confirmed = %t\n",	project_record.SCConfirmed)
-	fmt.Printf("Query (get_project): tb_dept = %s\n",	project_record.TBDept)
-	fmt.Printf("Query (get_project): tb_team = %s\n",	project_record.TBTeam)
-	fmt.Printf("Query (get_project): tb_person = %s\n",	project_record.TBPerson)
-	fmt.Printf("Query (get_project): tb_amount = %f\n",	project_record.TBAmount)
-	fmt.Printf("Query (get_project): tb_confirmed = %t\n",	project_record.TBConfirmed)
-
-	bytes, err := json.Marshal(project_record)
+	calendar, err := t.get_fiscal_calendar(stub)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+		return snapshot, err
 	}
-	fmt.Println("Returning from get_project")
-	return []byte(bytes), nil
-}
-
-//
-// get_distribution
-//
-func (t *SimpleChaincode) get_distribution(stub *shim.ChaincodeStub, project_id string) ([]byte, error) {
-	fmt.Println("Entering into get_distribution")
-	var err				error
-	var distribution_record		Distribution
-
-	// Get the state from the ledger
-	distribution_key := "distribution/" + project_id
-	distribution_asbytes, err := stub.GetState(distribution_key)
+	start, end := calendar.year_range(year)
+	entries, err := t.get_account_journal(stub, entity)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+		return snapshot, err
 	}
-	err = json.Unmarshal(distribution_asbytes, &distribution_record)
+
+	// Back from the current balance: later movements out of the closing, the year's out of the opening
+	snapshot.Entity = entity
+	snapshot.Year = year
+	snapshot.Currency = REPORTING_CURRENCY
+	snapshot.Closing = amount_record.Amount
+	var movements	Money
+	for _, entry := range entries {
+		timestamp, err := time.Parse(time.RFC3339, entry.CreatedAt)
+		if err != nil {
+			return snapshot, errors.New("##### OpeEx1: Error parsing timestamp of journal entry " + strconv.FormatUint(entry.Sequence, 10) + " #####")
+		}
+		net, err := entry.net(entity)
+		if err != nil {
+			return snapshot, err
+		}
+		if !timestamp.Before(end) {
+			snapshot.Closing, err = snapshot.Closing.sub(net)
+		} else if !timestamp.Before(start) {
+			movements, err = movements.add(net)
+		}
+		if err != nil {
+			return snapshot, err
+		}
+	}
+	snapshot.Opening, err = snapshot.Closing.sub(movements)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(distribution_asbytes) + " #####")
+		return snapshot, err
 	}
-	fmt.Printf("Query (get_distribution): project_id = %s\n",	project_id)
-	fmt.Printf("Query (get_distribution): currency = %s\n",		distribution_record.Currency)
-	fmt.Printf("Query (get_distribution): issue_rate = %f\n",	distribution_record.IssueRate)
-	fmt.Printf("Query (get_distribution): issue_amount = %f\n",	distribution_record.IssueAmount)
-	fmt.Printf("Query (get_distribution): issuer = %s\n",		distribution_record.Issuer)
-	fmt.Printf("Query (get_distribution): issue_year = %d\n",	distribution_record.IssueYear)
-	fmt.Printf("Query (get_distribution): bk_dept = %s\n",		distribution_record.BKDept)
-	fmt.Printf("Query (get_distribution): bk_team = %s\n",		distribution_record.BKTeam)
-	fmt.Printf("Query (get_distribution): bk_person = %s\n",	distribution_record.BKPerson)
-	fmt.Printf("Query (get_distribution): bk_amount = %f\n",	distribution_record.BKAmount)
-	fmt.Printf("Query (get_distribution): sc_dept = %s\n",		distribution_record.SCDept)
-	fmt.Printf("Query (get_distribution): sc_team = %s\n",		distribution_record.SCTeam)
-	fmt.Printf("Query (get_distribution): sc_person = %s\n",	distribution_record.SCPerson)
-	fmt.Printf("Query (get_distribution): sc_amount = %f\n",	distribution_record.SCAmount)
-	fmt.Printf("Query (get_distribution): tb_dept = %s\n",		distribution_record.TBDept)
-	fmt.Printf("Query (get_distribution): tb_team = %s\n",		distribution_record.TBTeam)
-	fmt.Printf("Query (get_distribution): tb_person = %s\n",	distribution_record.TBPerson)
-	fmt.Printf("Query (get_distribution): tb_amount = %f\n",	distribution_record.TBAmount)
 
-	bytes, err := json.Marshal(distribution_record)
+	previous_asbytes, err := stub.GetState("snapshot/" + strconv.FormatUint(uint64(year - 1), 10) + "/" + entity)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+		return snapshot, errors.New("##### OpeEx1: Failed to get state for snapshot of the year before #####")
 	}
-	fmt.Println("Returning from get_distribution")
-	return []byte(bytes), nil
+	if previous_asbytes != nil {
+		var previous	BalanceSnapshot
+		err = json.Unmarshal(previous_asbytes, &previous)
+		if err != nil {
+			return snapshot, errors.New("##### OpeEx1: Error unmarshalling data " + string(previous_asbytes) + " #####")
+		}
+		snapshot.Opening = previous.Closing
+	}
+	return snapshot, nil
 }
 
 //
-// get_receivable
+// LedgerAuditLine: reconcile works out Expected and Difference from the other fields
 //
-func (t *SimpleChaincode) get_receivable(stub *shim.ChaincodeStub, project_id string) ([]byte, error) {
-	fmt.Println("Entering into get_receivable")
-	var err			error
-	var receivable_record	Receivable
+func (l *LedgerAuditLine) reconcile() error {
+	var err	error
 
-	// Get the state from the ledger
-	receivable_key := "receivable/" + project_id
-	receivable_asbytes, err := stub.GetState(receivable_key)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for project_id: " + project_id + " #####")
+	l.Expected, err = l.Issued.add(l.Allocated)
+	if err == nil {
+		l.Expected, err = l.Expected.sub(l.Paid)
 	}
-	err = json.Unmarshal(receivable_asbytes, &receivable_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(receivable_asbytes) + " #####")
+	if err == nil {
+		l.Expected, err = l.Expected.add(l.Received)
 	}
-	fmt.Printf("Query (get_receivable): project_id = %s\n",		project_id)
-	fmt.Printf("Query (get_receivable): currency = %s\n",		receivable_record.Currency)
-	fmt.Printf("Query (get_receivable): amc_percent = %f\n",	receivable_record.AMCPercent)
-	fmt.Printf("Query (get_receivable): amc_amount = %f\n",		receivable_record.AMCAmount)
-	fmt.Printf("Query (get_receivable): gcc_percent = %f\n",	receivable_record.GCCPercent)
-	fmt.Printf("Query (get_receivable): gcc_amount = %f\n",		receivable_record.GCCAmount)
-	fmt.Printf("Query (get_receivable): gmc_percent = %f\n",	receivable_record.GMCPercent)
-	fmt.Printf("Query (get_receivable): gmc_amount = %f\n",		receivable_record.GMCAmount)
-	fmt.Printf("Query (get_receivable): rbbc_percent = %f\n",	receivable_record.RBBCPercent)
-	fmt.Printf("Query (get_receivable): rbbc_amount = %f\n",	receivable_record.RBBCAmount)
-	fmt.Printf("Query (get_receivable): cic_percent = %f\n",	receivable_record.CICPercent)
-	fmt.Printf("Query (get_receivable): cic_amount = %f\n",		receivable_record.CICAmount)
-
-	bytes, err := json.Marshal(receivable_record)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	if err == nil {
+		l.Expected, err = l.Expected.sub(l.Sent)
 	}
-	fmt.Println("Returning from get_receivable")
-	return []byte(bytes), nil
+	if err == nil {
+		l.Difference, err = l.Balance.sub(l.Expected)
+	}
+	return err
 }
 
 //
-// get_current_amount
+// audit_ledger recomputes the balance of every entity from the issue/, project/ and
+// transfer/ keys and the holdings of the reservation/ keys, and compares them with Amount
 //
-func (t *SimpleChaincode) get_current_amount(stub *shim.ChaincodeStub, entity string) ([]byte, error) {
-	fmt.Println("Entering into get_current_amount")
-	var err			error
-	var amount_record	Amount
+func (t *SimpleChaincode) audit_ledger(stub LedgerStub) ([]byte, error) {
+	fmt.Println("Entering into audit_ledger")
+	var audit	LedgerAudit
 
-	// Get the state from the ledger
-	amount_asbytes, err := stub.GetState(entity)
-	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for entity: " + entity + " #####")
+	lines := map[string]*LedgerAuditLine{}
+	line := func(entity string) *LedgerAuditLine {
+		if lines[entity] == nil {
+			lines[entity] = &LedgerAuditLine{Entity: entity}
+		}
+		return lines[entity]
+	}
+	involved := map[string]map[string]bool{}
+	involve := func(l *LedgerAuditLine, project_id string) {
+		if involved[l.Entity] == nil {
+			involved[l.Entity] = map[string]bool{}
+		}
+		if !involved[l.Entity][project_id] {
+			involved[l.Entity][project_id] = true
+			l.ProjectIds = append(l.ProjectIds, project_id)
+		}
 	}
 
-	err = json.Unmarshal(amount_asbytes, &amount_record)
+	entities, err := t.get_all_entities(stub)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(amount_asbytes) + " #####")
+		return nil, err
+	}
+	for _, entity_record := range entities {
+		amount_record, err := t.get_amount(stub, entity_record.Code)
+		if err != nil {
+			return nil, err
+		}
+		l := line(entity_record.Code)
+		l.Balance = amount_record.Amount
+		l.Reserved = amount_record.Reserved
 	}
-	fmt.Printf("Query (get_current_amount): entity = %s\n",	entity)
-	fmt.Printf("Query (get_current_amount): amount = %f\n",	amount_record.Amount)
 
-	bytes, err := json.Marshal(amount_record)
+	// Issues, in key order, so by project
+	iter, err := stub.RangeQueryState("issue/", "issue/~")
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, issue_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var issue_record Issue
+		err = json.Unmarshal(issue_asbytes, &issue_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
+		}
+		err = issue_record.normalize()
+		if err != nil {
+			return nil, err
+		}
+		l := line(issue_record.Issuer)
+		l.Issued, err = l.Issued.add(issue_record.ReportingAmount)
+		if err != nil {
+			return nil, err
+		}
+		audit.TotalIssued, err = audit.TotalIssued.add(issue_record.ReportingAmount)
+		if err != nil {
+			return nil, err
+		}
+		involve(l, issue_record.ProjectId)
 	}
-	fmt.Println("Returning from get_current_amount")
-	return []byte(bytes), nil
-}
 
-//
-// get_ranking
-//
-func (t *SimpleChaincode) get_ranking(stub *shim.ChaincodeStub, ranking_year uint64, ranking_person string) ([]byte, error) {
-	fmt.Println("Entering into get_ranking")
-	var err			error
-	var ranking_record	Ranking
-	
-	// Get the state from the ledger
-	year_str := strconv.FormatUint(ranking_year, 10)
-	ranking_key := "ranking/" + year_str + "/" + ranking_person
-	ranking_asbytes, err := stub.GetState(ranking_key)
+	// Confirmed allocations, paid by the current issuer
+	issuer, err := t.get_issuer(stub)
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Failed to get state for ranking_key: " + ranking_key + " #####")
+		return nil, err
 	}
-	err = json.Unmarshal(ranking_asbytes, &ranking_record)
+	project_iter, err := stub.RangeQueryState("project/", "project/~")
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(ranking_asbytes) + " #####")
+		return nil, errors.New("Unable to start the iterator")
 	}
-	fmt.Printf("Query (get_ranking): Year = %d\n",		ranking_record.Year)
-	fmt.Printf("Query (get_ranking): Rank = %d\n",		ranking_record.Rank)
-	fmt.Printf("Query (get_ranking): Person = %s\n",	ranking_record.Person)
-	fmt.Printf("Query (get_ranking): URL = %s\n",		ranking_record.URL)	
+	defer project_iter.Close()
+	for project_iter.HasNext() {
+		_, project_asbytes, iterErr := project_iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		var project_record Project
+		err = json.Unmarshal(project_asbytes, &project_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+		}
+		project_record.normalize()
+		for _, participant := range project_record.Participants {
+			if !participant.Confirmed {
+				continue
+			}
+			l := line(participant.Entity)
+			l.Allocated, err = l.Allocated.add(participant.Amount)
+			if err != nil {
+				return nil, err
+			}
+			involve(l, project_record.ProjectId)
+			l = line(issuer)
+			l.Paid, err = l.Paid.add(participant.Amount)
+			if err != nil {
+				return nil, err
+			}
+			involve(l, project_record.ProjectId)
+			audit.TotalAllocated, err = audit.TotalAllocated.add(participant.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	bytes, err := json.Marshal(ranking_record)
+		reservation, err := t.get_reservation(stub, project_record.ProjectId)
+		if err != nil {
+			return nil, err
+		}
+		if reservation != nil && reservation.Amount != 0 {
+			l := line(reservation.Entity)
+			l.Held, err = l.Held.add(reservation.Amount)
+			if err != nil {
+				return nil, err
+			}
+			involve(l, project_record.ProjectId)
+		}
+	}
+
+	// Transfers, moving balances outside of issues and projects
+	transfers, err := t.get_all_transfer(stub, "")
 	if err != nil {
-		return nil, errors.New("##### OpeEx1: Error creating returning Ranking record #####")
+		return nil, err
 	}
-	fmt.Println("Returning from get_ranking")
+	for _, transfer_record := range transfers {
+		l := line(transfer_record.From)
+		l.Sent, err = l.Sent.add(transfer_record.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if transfer_record.ProjectId != "" {
+			involve(l, transfer_record.ProjectId)
+		}
+		l = line(transfer_record.To)
+		l.Received, err = l.Received.add(transfer_record.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if transfer_record.ProjectId != "" {
+			involve(l, transfer_record.ProjectId)
+		}
+	}
+
+	// Sorted so that the report is the same on every peer
+	var codes	[]string
+	for code := range lines {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		l := lines[code]
+		sort.Strings(l.ProjectIds)
+		err = l.reconcile()
+		if err != nil {
+			return nil, err
+		}
+		audit.Entities = append(audit.Entities, *l)
+		if l.Difference != 0 || l.Reserved != l.Held {
+			fmt.Printf("Query (audit_ledger): %s: balance = %s, expected = %s, reserved = %s, held = %s\n",
+				l.Entity, l.Balance, l.Expected, l.Reserved, l.Held)
+			audit.Mismatches = append(audit.Mismatches, *l)
+		}
+	}
+
+	bytes, err := json.Marshal(audit)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from audit_ledger")
 	return []byte(bytes), nil
 }
 
 //
-// get_all_project
+// get_all_journal
 //
-func (t *SimpleChaincode) get_all_project(stub *shim.ChaincodeStub) ([]byte, error) {
-	fmt.Println("Entering into get_all_project")
-	var err			error
-	var project_record	Project
-	var project_set		ProjectSet
+func (t *SimpleChaincode) get_all_journal(stub LedgerStub) ([]byte, error) {
+	fmt.Println("Entering into get_all_journal")
+	var entries	[]JournalEntry
 
-	iter, err := stub.RangeQueryState("project/", "project/~")
+	iter, err := stub.RangeQueryState("journal/", "journal/~")
 	if err != nil {
 		return nil, errors.New("Unable to start the iterator")
 	}
 	defer iter.Close()
 	for iter.HasNext() {
-		_, project_asbytes, iterErr := iter.Next()
+		_, entry_asbytes, iterErr := iter.Next()
 		if iterErr != nil {
 			return nil, errors.New("keys operation failed. Error accessing next state")
 		}
-		err = json.Unmarshal(project_asbytes, &project_record)
+		var entry JournalEntry
+		err = json.Unmarshal(entry_asbytes, &entry)
 		if err != nil {
-			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(project_asbytes) + " #####")
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(entry_asbytes) + " #####")
 		}
-		project_set.Projects = append(project_set.Projects, project_record)
+		entries = append(entries, entry)
 	}
-	bytes, err := json.Marshal(project_set.Projects)
+	bytes, err := json.Marshal(entries)
 	if err != nil {
 		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
 	}
-	fmt.Println("Returning from get_all_project")
+	fmt.Println("Returning from get_all_journal")
 	return []byte(bytes), nil
 }
 
 //
 // get_all_issue
 //
-func (t *SimpleChaincode) get_all_issue(stub *shim.ChaincodeStub) ([]byte, error) {
+func (t *SimpleChaincode) get_all_issue(stub LedgerStub, issue_year uint16) ([]byte, error) {
 	fmt.Println("Entering into get_all_issue")
 	var err			error
 	var issue_record	Issue
@@ -1299,6 +6700,13 @@ func (t *SimpleChaincode) get_all_issue(stub *shim.ChaincodeStub) ([]byte, error
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(issue_asbytes) + " #####")
 		}
+		err = issue_record.normalize()
+		if err != nil {
+			return nil, err
+		}
+		if issue_year != 0 && issue_record.IssueYear != issue_year {
+			continue
+		}
 		issue_set.Issues = append(issue_set.Issues, issue_record)
 	}
 	bytes, err := json.Marshal(issue_set.Issues)
@@ -1312,10 +6720,9 @@ func (t *SimpleChaincode) get_all_issue(stub *shim.ChaincodeStub) ([]byte, error
 //
 // get_all_distribution
 //
-func (t *SimpleChaincode) get_all_distribution(stub *shim.ChaincodeStub) ([]byte, error) {
+func (t *SimpleChaincode) get_all_distribution(stub LedgerStub, issue_year uint16) ([]byte, error) {
 	fmt.Println("Entering into get_all_distribution")
 	var err				error
-	var distribution_record		Distribution
 	var distribution_set		DistributionSet
 
 	iter, err := stub.RangeQueryState("distribution/", "distribution/~")
@@ -1328,10 +6735,15 @@ func (t *SimpleChaincode) get_all_distribution(stub *shim.ChaincodeStub) ([]byte
 		if iterErr != nil {
 			return nil, errors.New("keys operation failed. Error accessing next state")
 		}
+		var distribution_record Distribution
 		err = json.Unmarshal(distribution_asbytes, &distribution_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(distribution_asbytes) + " #####")
 		}
+		distribution_record.normalize()
+		if issue_year != 0 && distribution_record.IssueYear != issue_year {
+			continue
+		}
 		distribution_set.Distributions = append(distribution_set.Distributions, distribution_record)
 	}
 	bytes, err := json.Marshal(distribution_set.Distributions)
@@ -1345,10 +6757,9 @@ func (t *SimpleChaincode) get_all_distribution(stub *shim.ChaincodeStub) ([]byte
 //
 // get_all_receivable
 //
-func (t *SimpleChaincode) get_all_receivable(stub *shim.ChaincodeStub) ([]byte, error) {
+func (t *SimpleChaincode) get_all_receivable(stub LedgerStub) ([]byte, error) {
 	fmt.Println("Entering into get_all_receivable")
 	var err				error
-	var receivable_record		Receivable
 	var receivable_set		ReceivableSet
 
 	iter, err := stub.RangeQueryState("receivable/", "receivable/~")
@@ -1361,10 +6772,12 @@ func (t *SimpleChaincode) get_all_receivable(stub *shim.ChaincodeStub) ([]byte,
 		if iterErr != nil {
 			return nil, errors.New("keys operation failed. Error accessing next state")
 		}
+		var receivable_record Receivable
 		err = json.Unmarshal(receivable_asbytes, &receivable_record)
 		if err != nil {
 			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(receivable_asbytes) + " #####")
 		}
+		receivable_record.normalize()
 		receivable_set.Receivables = append(receivable_set.Receivables, receivable_record)
 	}
 	bytes, err := json.Marshal(receivable_set.Receivables)
@@ -1375,6 +6788,39 @@ func (t *SimpleChaincode) get_all_receivable(stub *shim.ChaincodeStub) ([]byte,
 	return []byte(bytes), nil
 }
 
+//
+// get_all_rate
+//
+func (t *SimpleChaincode) get_all_rate(stub LedgerStub) ([]byte, error) {
+	fmt.Println("Entering into get_all_rate")
+	var err			error
+	var rate_record		Rate
+	var rate_set		RateSet
+
+	iter, err := stub.RangeQueryState("rate/", "rate/~")
+	if err != nil {
+		return nil, errors.New("Unable to start the iterator")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		_, rate_asbytes, iterErr := iter.Next()
+		if iterErr != nil {
+			return nil, errors.New("keys operation failed. Error accessing next state")
+		}
+		err = json.Unmarshal(rate_asbytes, &rate_record)
+		if err != nil {
+			return nil, errors.New("##### OpeEx1: Error unmarshalling data " + string(rate_asbytes) + " #####")
+		}
+		rate_set.Rates = append(rate_set.Rates, rate_record)
+	}
+	bytes, err := json.Marshal(rate_set.Rates)
+	if err != nil {
+		return nil, errors.New("##### OpeEx1: Error creating returning record #####")
+	}
+	fmt.Println("Returning from get_all_rate")
+	return []byte(bytes), nil
+}
+
 //
 // Main
 //
@@ -0,0 +1,1037 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+//
+// MockStub is a LedgerStub kept in memory
+//
+type MockStub struct {
+	State	map[string][]byte
+	TxId	string
+	Time	time.Time
+	Cert	[]byte
+}
+
+func (s *MockStub) GetState(key string) ([]byte, error) {
+	return s.State[key], nil
+}
+
+func (s *MockStub) PutState(key string, value []byte) error {
+	s.State[key] = value
+	return nil
+}
+
+func (s *MockStub) RangeQueryState(startKey string, endKey string) (StateIterator, error) {
+	var keys	[]string
+
+	for key := range s.State {
+		if key >= startKey && key < endKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &MockIterator{ stub: s, keys: keys }, nil
+}
+
+func (s *MockStub) GetCallerCertificate() ([]byte, error) {
+	return s.Cert, nil
+}
+
+func (s *MockStub) GetTxID() string {
+	return s.TxId
+}
+
+func (s *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{ Seconds: s.Time.Unix(), Nanos: int32(s.Time.Nanosecond()) }, nil
+}
+
+//
+// MockIterator walks the keys of a range in order
+//
+type MockIterator struct {
+	stub	*MockStub
+	keys	[]string
+}
+
+func (i *MockIterator) HasNext() bool {
+	return len(i.keys) > 0
+}
+
+func (i *MockIterator) Next() (string, []byte, error) {
+	key := i.keys[0]
+	i.keys = i.keys[1:]
+	return key, i.stub.State[key], nil
+}
+
+func (i *MockIterator) Close() error {
+	return nil
+}
+
+//
+// Ledger runs transactions against a MockStub as one user at a time, one
+// minute apart from 2016-10-01 (FY2016) unless moved with at
+//
+type Ledger struct {
+	t		*testing.T
+	cc		*SimpleChaincode
+	stub		*MockStub
+	certs		map[string][]byte
+	sequence	int
+}
+
+func new_ledger(t *testing.T) *Ledger {
+	l := &Ledger{
+		t:	t,
+		cc:	new(SimpleChaincode),
+		stub:	&MockStub{ State: map[string][]byte{}, Time: time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC) },
+		certs:	map[string][]byte{},
+	}
+	l.as("admin")
+	l.next()
+	_, err := l.cc.init_ledger(l.stub, "init", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+//
+// as makes user the caller of the following transactions
+//
+func (l *Ledger) as(user string) {
+	if l.certs[user] == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			l.t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:	big.NewInt(int64(len(l.certs) + 1)),
+			Subject:	pkix.Name{ CommonName: user },
+			NotBefore:	time.Now(),
+			NotAfter:	time.Now().Add(time.Hour),
+		}
+		l.certs[user], err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			l.t.Fatal(err)
+		}
+	}
+	l.stub.Cert = l.certs[user]
+}
+
+//
+// at moves the clock of the following transactions to date
+//
+func (l *Ledger) at(date time.Time) {
+	l.stub.Time = date
+}
+
+func (l *Ledger) next() {
+	l.sequence++
+	l.stub.TxId = fmt.Sprintf("tx%d", l.sequence)
+	l.stub.Time = l.stub.Time.Add(time.Minute)
+}
+
+//
+// invoke runs function as one transaction, nothing of which is kept if it fails
+//
+func (l *Ledger) invoke(function string, args ...string) error {
+	l.next()
+	saved := map[string][]byte{}
+	for key, value := range l.stub.State {
+		saved[key] = value
+	}
+	_, err := l.cc.invoke(l.stub, function, args)
+	if err != nil {
+		l.stub.State = saved
+	}
+	return err
+}
+
+func (l *Ledger) ok(function string, args ...string) {
+	err := l.invoke(function, args...)
+	if err != nil {
+		l.t.Fatalf("%s %v: %v", function, args, err)
+	}
+}
+
+func (l *Ledger) fail(function string, args ...string) error {
+	err := l.invoke(function, args...)
+	if err == nil {
+		l.t.Fatalf("%s %v was accepted", function, args)
+	}
+	return err
+}
+
+//
+// query runs a query and unmarshals its result into result
+//
+func (l *Ledger) query(result interface{}, function string, args ...string) {
+	bytes, err := l.cc.query(l.stub, function, args)
+	if err != nil {
+		l.t.Fatalf("%s %v: %v", function, args, err)
+	}
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		l.t.Fatalf("%s %v: %v in %s", function, args, err, bytes)
+	}
+}
+
+//
+// amount returns the current balance of entity
+//
+func (l *Ledger) amount(entity string) Money {
+	var amount_record	Amount
+
+	l.query(&amount_record, "get_current_amount", entity)
+	return amount_record.Amount
+}
+
+func (l *Ledger) project(project_id string) Project {
+	var project_record	Project
+
+	l.query(&project_record, "get_project", project_id)
+	return project_record
+}
+
+//
+// verify fails the test if verify_journal finds an entry or a balance out of line
+//
+func (l *Ledger) verify() JournalReport {
+	var report	JournalReport
+
+	l.query(&report, "verify_journal")
+	if len(report.Unbalanced) != 0 || len(report.Mismatches) != 0 {
+		l.t.Errorf("verify_journal: %+v", report)
+	}
+	return report
+}
+
+//
+// journal returns the journal entries of account
+//
+func (l *Ledger) journal(account string) []JournalEntry {
+	var entries	[]JournalEntry
+
+	l.query(&entries, "get_journal", account)
+	return entries
+}
+
+//
+// project_args returns the args of project with the five legacy beneficiaries at
+// 20 percent and BK, SC and TB taking bk, sc and tb, "-" for not participating
+//
+func project_args(project_id string, invest_amount string, bk string, sc string, tb string) []string {
+	args := []string{project_id, "Project " + project_id, "equity", invest_amount, "20", "20", "20", "20", "20"}
+	for _, amount := range []string{bk, sc, tb} {
+		args = append(args, "dept", "team", "person", amount)
+	}
+	return args
+}
+
+func TestInvokeArgsCoverDispatch(t *testing.T) {
+	l := new_ledger(t)
+	for function := range INVOKE_ARGS {
+		err := l.invoke(function)
+		if err != nil && strings.Contains(err.Error(), "unknown function") {
+			t.Errorf("Invoke does not dispatch %s: %v", function, err)
+		}
+	}
+	err := l.invoke("no_such_function")
+	if err == nil || !strings.Contains(err.Error(), "unknown function") {
+		t.Errorf("Invoke of an unknown function: %v", err)
+	}
+}
+
+func TestQueryArgsCoverDispatch(t *testing.T) {
+	l := new_ledger(t)
+	for function := range QUERY_ARGS {
+		_, err := l.cc.query(l.stub, function, nil)
+		if err != nil && strings.Contains(err.Error(), "unknown function") {
+			t.Errorf("Query does not dispatch %s: %v", function, err)
+		}
+	}
+	_, err := l.cc.query(l.stub, "no_such_function", nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown function") {
+		t.Errorf("Query of an unknown function: %v", err)
+	}
+}
+
+func TestRoundRat(t *testing.T) {
+	for _, c := range []struct {
+		num, denom	int64
+		mode		string
+		want		int64
+		exact		bool
+	}{
+		{5, 2, ROUND_HALF_UP, 3, false},
+		{5, 2, ROUND_HALF_EVEN, 2, false},
+		{5, 2, ROUND_DOWN, 2, false},
+		{-5, 2, ROUND_HALF_UP, -3, false},
+		{-5, 2, ROUND_HALF_EVEN, -2, false},
+		{-5, 2, ROUND_DOWN, -2, false},
+		{7, 2, ROUND_HALF_UP, 4, false},
+		{7, 2, ROUND_HALF_EVEN, 4, false},
+		{7, 2, ROUND_DOWN, 3, false},
+		{-7, 2, ROUND_HALF_EVEN, -4, false},
+		{2, 3, ROUND_HALF_UP, 1, false},
+		{2, 3, ROUND_HALF_EVEN, 1, false},
+		{2, 3, ROUND_DOWN, 0, false},
+		{-2, 3, ROUND_HALF_UP, -1, false},
+		{-2, 3, ROUND_DOWN, 0, false},
+		{1, 3, ROUND_HALF_UP, 0, false},
+		{8, 2, ROUND_HALF_UP, 4, true},
+		{-8, 2, ROUND_DOWN, -4, true},
+	} {
+		n, exact := round_rat(big.NewRat(c.num, c.denom), c.mode)
+		if n.Int64() != c.want || exact != c.exact {
+			t.Errorf("round_rat(%d/%d, %s) = %s, %v, want %d, %v", c.num, c.denom, c.mode, n, exact, c.want, c.exact)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, c := range []struct {
+		value		string
+		mode		string
+		want		int64
+		exact		bool
+	}{
+		{"1.23456", ROUND_HALF_UP, 12346, false},
+		{"1.23456", ROUND_HALF_EVEN, 12346, false},
+		{"1.23456", ROUND_DOWN, 12345, false},
+		{"0.00005", ROUND_HALF_UP, 1, false},
+		{"0.00005", ROUND_HALF_EVEN, 0, false},
+		{"0.00005", ROUND_DOWN, 0, false},
+		{"0.00015", ROUND_HALF_EVEN, 2, false},
+		{"0.00015", ROUND_DOWN, 1, false},
+		{"-0.00005", ROUND_HALF_UP, -1, false},
+		{"-0.00005", ROUND_HALF_EVEN, 0, false},
+		{"-0.00019", ROUND_DOWN, -1, false},
+		{"+12", ROUND_HALF_UP, 120000, true},
+		{" 1.5 ", ROUND_HALF_UP, 15000, true},
+		{"922337203685477.5807", ROUND_DOWN, math.MaxInt64, true},
+		{"-922337203685477.5807", ROUND_DOWN, -math.MaxInt64, true},
+	} {
+		n, exact, err := parse_decimal(c.value, MONEY_SCALE, c.mode)
+		if err != nil || n != c.want || exact != c.exact {
+			t.Errorf("parse_decimal(%q, %s) = %d, %v, %v, want %d, %v", c.value, c.mode, n, exact, err, c.want, c.exact)
+		}
+	}
+	for _, value := range []string{"", "-", "1e3", "1/3", "0x10", ".5", "1.", "1,000", "Inf", "922337203685477.5808", "-922337203685477.5808"} {
+		if _, _, err := parse_decimal(value, MONEY_SCALE, ROUND_HALF_UP); err == nil {
+			t.Errorf("parse_decimal(%q) was accepted", value)
+		}
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	half := Ratio(RATIO_UNIT / 2)
+	for _, c := range []struct {
+		amount		Money
+		rate		Ratio
+		mode		string
+		want		Money
+	}{
+		{100 * MONEY_UNIT, Ratio(108.25 * RATIO_UNIT), ROUND_HALF_UP, 10825 * MONEY_UNIT},
+		{1, half, ROUND_HALF_UP, 1},
+		{1, half, ROUND_HALF_EVEN, 0},
+		{1, half, ROUND_DOWN, 0},
+		{3, half, ROUND_HALF_UP, 2},
+		{3, half, ROUND_HALF_EVEN, 2},
+		{3, half, ROUND_DOWN, 1},
+		{-1, half, ROUND_HALF_UP, -1},
+		{-1, half, ROUND_HALF_EVEN, 0},
+		{-3, half, ROUND_DOWN, -1},
+		{math.MaxInt64, RATIO_UNIT, ROUND_HALF_UP, math.MaxInt64},
+	} {
+		m, err := c.amount.convert(c.rate, c.mode)
+		if err != nil || m != c.want {
+			t.Errorf("%s.convert(%s, %s) = %s, %v, want %s", c.amount, c.rate, c.mode, m, err, c.want)
+		}
+	}
+	if _, err := Money(100000000000000 * MONEY_UNIT).convert(150 * RATIO_UNIT, ROUND_HALF_UP); err == nil {
+		t.Error("convert out of range was accepted")
+	}
+	if _, err := Money(math.MinInt64).convert(-RATIO_UNIT, ROUND_HALF_UP); err == nil {
+		t.Error("convert of the lowest Money at -1 was accepted")
+	}
+}
+
+func TestMoneyAddSub(t *testing.T) {
+	if m, err := Money(5).add(-7); err != nil || m != -2 {
+		t.Errorf("5 + -7 = %s, %v", m, err)
+	}
+	if m, err := Money(5).sub(7); err != nil || m != -2 {
+		t.Errorf("5 - 7 = %s, %v", m, err)
+	}
+	if _, err := Money(math.MaxInt64).add(1); err == nil {
+		t.Error("add out of range was accepted")
+	}
+	if _, err := Money(math.MinInt64).add(-1); err == nil {
+		t.Error("add out of range was accepted")
+	}
+	if _, err := Money(math.MinInt64 + 1).sub(2); err == nil {
+		t.Error("sub out of range was accepted")
+	}
+	if _, err := Money(0).sub(math.MinInt64); err == nil {
+		t.Error("sub of the lowest Money was accepted")
+	}
+}
+
+func TestAmountCover(t *testing.T) {
+	amount_record := Amount { Entity: "BK", Amount: 100 * MONEY_UNIT, Reserved: 30 * MONEY_UNIT }
+	if err := amount_record.cover(70 * MONEY_UNIT, "confirm"); err != nil {
+		t.Errorf("cover of all that is available failed: %v", err)
+	}
+	if err := amount_record.cover(70 * MONEY_UNIT + 1, "confirm"); err == nil {
+		t.Error("cover of more than is available was accepted")
+	}
+	overdrawn := Amount { Entity: "BK", Amount: -10 * MONEY_UNIT }
+	if err := overdrawn.cover(1, "transfer"); err == nil {
+		t.Error("cover from a negative amount was accepted")
+	}
+	if err := (Amount { Entity: "BK", Amount: math.MinInt64, Reserved: 1 }).cover(0, "confirm"); err == nil {
+		t.Error("cover with available out of range was accepted")
+	}
+}
+
+func TestBudgetStatusCheck(t *testing.T) {
+	if err := (BudgetStatus { Entity: "BK", Year: 2016 }).check(math.MaxInt64); err != nil {
+		t.Errorf("check without a budget failed: %v", err)
+	}
+	status := BudgetStatus { Entity: "BK", Year: 2016, Capped: true, Cap: 100 * MONEY_UNIT, Used: 60 * MONEY_UNIT, Remaining: 40 * MONEY_UNIT }
+	if err := status.check(40 * MONEY_UNIT); err != nil {
+		t.Errorf("check of all that remains failed: %v", err)
+	}
+	if err := status.check(40 * MONEY_UNIT + 1); err == nil {
+		t.Error("check of more than remains was accepted")
+	}
+	status.Used = 120 * MONEY_UNIT
+	status.Remaining = -20 * MONEY_UNIT
+	if err := status.check(1); err == nil {
+		t.Error("check over a budget already gone over was accepted")
+	}
+}
+
+func TestJournalEntryNet(t *testing.T) {
+	entry := JournalEntry { Lines: []JournalLine {
+		{ Account: "BK", Debit: 5 * MONEY_UNIT },
+		{ Account: "FG", Credit: 5 * MONEY_UNIT },
+		{ Account: "BK", Credit: 2 * MONEY_UNIT },
+	} }
+	if net, err := entry.net("BK"); err != nil || net != 3 * MONEY_UNIT {
+		t.Errorf("net of BK = %s, %v", net, err)
+	}
+	entry.Lines = append(entry.Lines, JournalLine { Account: "BK", Debit: math.MaxInt64 })
+	if _, err := entry.net("BK"); err == nil {
+		t.Error("net out of range was accepted")
+	}
+	if _, _, err := entry.totals(); err == nil {
+		t.Error("totals out of range were accepted")
+	}
+}
+
+func TestLedgerAuditLineReconcile(t *testing.T) {
+	l := LedgerAuditLine { Entity: "BK", Balance: 250, Allocated: 300, Received: 50, Sent: 100 }
+	if err := l.reconcile(); err != nil || l.Expected != 250 || l.Difference != 0 {
+		t.Errorf("reconcile = %s, %s, %v", l.Expected, l.Difference, err)
+	}
+	l = LedgerAuditLine { Entity: "FG", Issued: math.MaxInt64, Received: 1 }
+	if err := l.reconcile(); err == nil {
+		t.Error("reconcile out of range was accepted")
+	}
+}
+
+func TestFiscalYear(t *testing.T) {
+	jst := time.FixedZone("JST", 9 * 3600)
+	start := FiscalCalendar { StartMonth: 4, YearLabel: FY_LABEL_START, Quarters: []uint8{4, 7, 10, 1}, TimeZone: "JST", UTCOffset: 9 * 3600 }
+	end := start
+	end.YearLabel = FY_LABEL_END
+	january := FiscalCalendar { StartMonth: 1, YearLabel: FY_LABEL_END, Quarters: []uint8{1, 4, 7, 10}, TimeZone: "UTC" }
+	for _, c := range []struct {
+		calendar	FiscalCalendar
+		date		time.Time
+		want		uint16
+	}{
+		{start, time.Date(2016, 4, 1, 0, 0, 0, 0, jst), 2016},
+		{start, time.Date(2016, 3, 31, 23, 59, 59, 0, jst), 2015},
+		{start, time.Date(2016, 3, 31, 15, 0, 0, 0, time.UTC), 2016},
+		{start, time.Date(2016, 3, 31, 14, 59, 59, 0, time.UTC), 2015},
+		{start, time.Date(2017, 1, 15, 0, 0, 0, 0, jst), 2016},
+		{end, time.Date(2016, 4, 1, 0, 0, 0, 0, jst), 2017},
+		{end, time.Date(2016, 3, 31, 0, 0, 0, 0, jst), 2016},
+		{january, time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC), 2016},
+		{january, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 2017},
+	} {
+		if year := c.calendar.fiscal_year(c.date); year != c.want {
+			t.Errorf("fiscal_year(%s) with %s label = %d, want %d", c.date, c.calendar.YearLabel, year, c.want)
+		}
+	}
+}
+
+func TestFiscalYearRange(t *testing.T) {
+	jst := time.FixedZone("JST", 9 * 3600)
+	start := FiscalCalendar { StartMonth: 4, YearLabel: FY_LABEL_START, Quarters: []uint8{4, 7, 10, 1}, TimeZone: "JST", UTCOffset: 9 * 3600 }
+	end := start
+	end.YearLabel = FY_LABEL_END
+	for _, c := range []struct {
+		calendar	FiscalCalendar
+		year		uint16
+	}{
+		{start, 2016},
+		{end, 2017},
+	} {
+		from, to := c.calendar.year_range(c.year)
+		if !from.Equal(time.Date(2016, 4, 1, 0, 0, 0, 0, jst)) || !to.Equal(time.Date(2017, 4, 1, 0, 0, 0, 0, jst)) {
+			t.Errorf("year_range(%d) with %s label = %s - %s", c.year, c.calendar.YearLabel, from, to)
+		}
+		if c.calendar.fiscal_year(from) != c.year || c.calendar.fiscal_year(to.Add(-time.Nanosecond)) != c.year || c.calendar.fiscal_year(to) != c.year + 1 {
+			t.Errorf("year_range(%d) with %s label does not match fiscal_year", c.year, c.calendar.YearLabel)
+		}
+	}
+}
+
+func TestSetFiscalCalendar(t *testing.T) {
+	var period	FiscalPeriod
+
+	l := new_ledger(t)
+	l.query(&period, "get_fiscal_period", "2017-03-31")
+	if period.Year != 2016 || period.Quarter != 4 || period.YearStart != "2016-04-01T00:00:00+09:00" {
+		t.Errorf("default calendar: %+v", period)
+	}
+	l.fail("set_fiscal_calendar", "13", FY_LABEL_START, "UTC", "0")
+	l.fail("set_fiscal_calendar", "4", FY_LABEL_START, "UTC", "0", "4", "10", "7", "1")
+	l.ok("set_fiscal_calendar", "1", FY_LABEL_END, "UTC", "0")
+	l.query(&period, "get_fiscal_period", "2017-03-31")
+	if period.Year != 2017 || period.Quarter != 1 || period.YearEnd != "2018-01-01T00:00:00Z" {
+		t.Errorf("calendar year: %+v", period)
+	}
+}
+
+func TestConfirmSubmitsDraft(t *testing.T) {
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	if status := l.project("P1").Status; status != PROJECT_STATUS_DRAFT {
+		t.Fatalf("new project is %s", status)
+	}
+	l.ok("confirm", "P1", "BK")
+	if status := l.project("P1").Status; status != PROJECT_STATUS_PARTIALLY_CONFIRMED {
+		t.Errorf("project confirmed as a draft is %s", status)
+	}
+	l.ok("confirm", "P1", "SC")
+	l.ok("confirm", "P1", "TB")
+	if status := l.project("P1").Status; status != PROJECT_STATUS_CONFIRMED {
+		t.Errorf("project confirmed by all is %s", status)
+	}
+	if l.amount("FG") != 400 * MONEY_UNIT || l.amount("TB") != 300 * MONEY_UNIT {
+		t.Errorf("FG %s, TB %s", l.amount("FG"), l.amount("TB"))
+	}
+
+	l.ok("project", project_args("P2", "100", "100", "-", "-")...)
+	l.ok("cancel", "P2")
+	l.fail("confirm", "P2", "BK")
+	l.verify()
+}
+
+func TestUpdateProjectPostsDifference(t *testing.T) {
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "200", "100", "300")...)
+	l.ok("submit", "P1")
+	l.ok("confirm", "P1", "BK")
+	if l.amount("FG") != 800 * MONEY_UNIT || l.amount("BK") != 200 * MONEY_UNIT {
+		t.Fatalf("after confirm FG %s, BK %s", l.amount("FG"), l.amount("BK"))
+	}
+
+	l.ok("updateproject", project_args("P1", "600", "300", "100", "200")...)
+	if l.amount("FG") != 700 * MONEY_UNIT || l.amount("BK") != 300 * MONEY_UNIT {
+		t.Errorf("after updateproject FG %s, BK %s", l.amount("FG"), l.amount("BK"))
+	}
+	entries := l.journal("BK")
+	if len(entries) != 2 || entries[1].Function != "updateproject" || entries[1].Lines[0].Debit != 100 * MONEY_UNIT {
+		t.Errorf("journal of BK: %+v", entries)
+	}
+	if len(l.journal("TB")) != 0 {
+		t.Error("updateproject posted for TB, which has not confirmed")
+	}
+
+	l.ok("updateproject", project_args("P1", "600", "150", "150", "300")...)
+	if l.amount("FG") != 850 * MONEY_UNIT || l.amount("BK") != 150 * MONEY_UNIT {
+		t.Errorf("after lowering BK, FG %s, BK %s", l.amount("FG"), l.amount("BK"))
+	}
+	if report := l.verify(); report.Entries != 4 {
+		t.Errorf("%d journal entries, expecting issue, confirm and two updates", report.Entries)
+	}
+}
+
+func TestConfirmTwice(t *testing.T) {
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("submit", "P1")
+	l.ok("confirm", "P1", "SC")
+	l.ok("confirm", "P1", "SC")
+	l.ok("confirm", "P1", "SC", "r1")
+	l.ok("confirm", "P1", "SC", "r1")
+	if l.amount("SC") != 200 * MONEY_UNIT || l.amount("FG") != 800 * MONEY_UNIT {
+		t.Errorf("after confirming SC again, SC %s, FG %s", l.amount("SC"), l.amount("FG"))
+	}
+	if entries := l.journal("SC"); len(entries) != 1 {
+		t.Errorf("%d journal entries for SC", len(entries))
+	}
+	if confirmed_tx := l.project("P1").Participants[1].ConfirmedTx; confirmed_tx != "tx5" {
+		t.Errorf("SC was confirmed in %s, expecting the first confirm", confirmed_tx)
+	}
+
+	// A request id is kept with its args, another confirm under it is refused
+	l.fail("confirm", "P1", "BK", "r1")
+	l.ok("confirm", "P1", "BK", "r2")
+	l.ok("confirm", "P1", "BK", "r2")
+	if l.amount("BK") != 100 * MONEY_UNIT || l.amount("FG") != 700 * MONEY_UNIT {
+		t.Errorf("after confirming BK again, BK %s, FG %s", l.amount("BK"), l.amount("FG"))
+	}
+	if report := l.verify(); report.Entries != 3 {
+		t.Errorf("%d journal entries, expecting issue and two confirms", report.Entries)
+	}
+}
+
+func TestUpdateProjectKeepsRejection(t *testing.T) {
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("submit", "P1")
+	l.ok("confirm", "P1", "BK")
+	l.ok("reject", "P1", "SC", "too much")
+	l.ok("unconfirm", "P1", "BK", "wrong dept")
+
+	l.ok("updateproject", project_args("P1", "600", "100", "200", "300")...)
+	project_record := l.project("P1")
+	if project_record.Status != PROJECT_STATUS_RENEGOTIATION {
+		t.Errorf("project is %s", project_record.Status)
+	}
+	bk, sc := project_record.Participants[0], project_record.Participants[1]
+	if !sc.Rejected || sc.Reason != "too much" {
+		t.Errorf("SC after updateproject: %+v", sc)
+	}
+	if bk.Confirmed || bk.Reason != "wrong dept" {
+		t.Errorf("BK after updateproject: %+v", bk)
+	}
+
+	l.ok("updateproject", project_args("P1", "600", "100", "150", "350")...)
+	sc = l.project("P1").Participants[1]
+	if sc.Rejected || sc.Reason != "" {
+		t.Errorf("SC after its amount changed: %+v", sc)
+	}
+
+	l.ok("reject", "P1", "TB", "too little")
+	l.ok("patch_project", "P1", "participant.TB.person", "someone else")
+	if tb := l.project("P1").Participants[2]; !tb.Rejected {
+		t.Errorf("TB after a patch of its person: %+v", tb)
+	}
+	l.ok("patch_project", "P1", "participant.TB.amount", "350", "participant.SC.amount", "150")
+	if tb := l.project("P1").Participants[2]; !tb.Rejected {
+		t.Errorf("TB after a patch to the same amount: %+v", tb)
+	}
+	l.ok("patch_project", "P1", "participant.TB.amount", "400", "participant.SC.amount", "100")
+	if tb := l.project("P1").Participants[2]; tb.Rejected || tb.Reason != "" {
+		t.Errorf("TB after its amount changed: %+v", tb)
+	}
+	l.verify()
+}
+
+func TestCheckConsistency(t *testing.T) {
+	rules := []string{RULE_BENEFICIARY_PERCENT, RULE_PARTICIPANT_AMOUNT}
+	p := Project {
+		InvestAmount:	100 * MONEY_UNIT,
+		Beneficiaries:	[]BeneficiaryShare { { Code: "AMC", Percent: 50 * RATIO_UNIT }, { Code: "GCC", Percent: 50 * RATIO_UNIT + RATIO_UNIT / 250 } },
+		Participants:	[]Participant { { Entity: "BK", Amount: 60 * MONEY_UNIT }, { Entity: "SC", Amount: 45 * MONEY_UNIT } },
+	}
+	v := &Validator{}
+	p.check_consistency(v, rules, 5 * MONEY_UNIT, DEFAULT_PERCENT_TOLERANCE)
+	if len(v.Errors) != 0 {
+		t.Errorf("within tolerance: %+v", v.Errors)
+	}
+
+	// The amount tolerance is no tolerance for percents
+	p.Beneficiaries[1].Percent = 51 * RATIO_UNIT
+	v = &Validator{}
+	p.check_consistency(v, rules, 5 * MONEY_UNIT, DEFAULT_PERCENT_TOLERANCE)
+	if len(v.Errors) != 1 || v.Errors[0].Field != "beneficiaries" {
+		t.Errorf("percents 1 over: %+v", v.Errors)
+	}
+	v = &Validator{}
+	p.check_consistency(v, rules, 5 * MONEY_UNIT, RATIO_UNIT)
+	if len(v.Errors) != 0 {
+		t.Errorf("percents 1 over with a percent tolerance of 1: %+v", v.Errors)
+	}
+
+	p.Beneficiaries[1].Percent = math.MaxInt64
+	p.Participants[1].Amount = math.MaxInt64
+	v = &Validator{}
+	p.check_consistency(v, rules, 5 * MONEY_UNIT, RATIO_UNIT)
+	if len(v.Errors) != 2 {
+		t.Errorf("totals out of range: %+v", v.Errors)
+	}
+}
+
+func TestSetConsistencyRules(t *testing.T) {
+	var config	ConsistencyConfig
+
+	l := new_ledger(t)
+	l.query(&config, "get_consistency_rules")
+	if config.Tolerance != MONEY_UNIT / 200 || config.PercentTolerance != DEFAULT_PERCENT_TOLERANCE {
+		t.Errorf("default: %+v", config)
+	}
+	l.ok("set_consistency_rules", "10", RULE_BENEFICIARY_PERCENT)
+	l.query(&config, "get_consistency_rules")
+	if config.Tolerance != 10 * MONEY_UNIT || config.PercentTolerance != DEFAULT_PERCENT_TOLERANCE || len(config.Rules) != 1 {
+		t.Errorf("without a percent tolerance: %+v", config)
+	}
+	l.ok("set_consistency_rules", `{"tolerance":"10","percent_tolerance":"0.5","rules":["beneficiary_percent","participant_amount"]}`)
+	l.query(&config, "get_consistency_rules")
+	if config.PercentTolerance != RATIO_UNIT / 2 || len(config.Rules) != 2 {
+		t.Errorf("with a percent tolerance: %+v", config)
+	}
+	l.ok("set_consistency_rules", `{"tolerance":"10","rules":["participant_amount"]}`)
+	l.query(&config, "get_consistency_rules")
+	if config.PercentTolerance != DEFAULT_PERCENT_TOLERANCE || len(config.Rules) != 1 {
+		t.Errorf("percent tolerance left out: %+v", config)
+	}
+	l.fail("set_consistency_rules", "10", "-1")
+	l.fail("set_consistency_rules", "10", "0.5", "no_such_rule")
+
+	// Percents 0.1 over are refused although the amount tolerance is 10
+	l.ok("set_consistency_rules", "10", RULE_BENEFICIARY_PERCENT)
+	args := project_args("P1", "600", "100", "200", "300")
+	args[8] = "20.1"
+	l.fail("project", args...)
+	l.ok("set_consistency_rules", "10", "0.1", RULE_BENEFICIARY_PERCENT)
+	l.ok("project", args...)
+}
+
+func TestSetProjectBeneficiaries(t *testing.T) {
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	version := l.project("P1").Version
+	l.ok("set_project_beneficiaries", "P1", "AMC", "60", "GCC", "40")
+	project_record := l.project("P1")
+	if len(project_record.Beneficiaries) != 2 || project_record.Version != version + 1 {
+		t.Errorf("after set_project_beneficiaries: version %d, %+v", project_record.Version, project_record.Beneficiaries)
+	}
+
+	l.ok("confirm", "P1", "BK")
+	l.ok("confirm", "P1", "SC")
+	l.ok("confirm", "P1", "TB")
+	l.ok("set_project_beneficiaries", "P1", "AMC", "50", "GCC", "50")
+	l.ok("close", "P1")
+	l.fail("set_project_beneficiaries", "P1", "AMC", "100")
+
+	l.ok("project", project_args("P2", "100", "100", "-", "-")...)
+	l.ok("cancel", "P2")
+	l.fail("set_project_beneficiaries", "P2", "AMC", "100")
+
+	project_record = l.project("P1")
+	if project_record.Beneficiaries[0].Percent != 50 * RATIO_UNIT || project_record.Status != PROJECT_STATUS_CLOSED {
+		t.Errorf("closed project: %+v", project_record)
+	}
+}
+
+func TestLegacyProjectVersion(t *testing.T) {
+	var versions	[]ProjectVersion
+	var version_record	ProjectVersion
+
+	l := new_ledger(t)
+	l.ok("issue", "P0", "1000")
+	l.stub.State["project/P0"] = []byte(`{"project_id":"P0","project_name":"Legacy","invest_type":"equity","invest_amount":600,"confirmed":false,` +
+		`"amc_percent":20,"gcc_percent":20,"gmc_percent":20,"rbbc_percent":20,"cic_percent":20,` +
+		`"bk_dept":"d","bk_team":"t","bk_person":"p","bk_amount":100,"bk_confirmed":false,` +
+		`"sc_dept":"d","sc_team":"t","sc_person":"p","sc_amount":200,"sc_confirmed":false,` +
+		`"tb_dept":"d","tb_team":"t","tb_person":"p","tb_amount":300,"tb_confirmed":false}`)
+	l.ok("confirm", "P0", "BK")
+	l.ok("confirm", "P0", "SC")
+
+	l.query(&versions, "get_project_history", "P0")
+	if len(versions) != 3 || versions[0].Version != 0 || versions[1].Version != 1 || versions[2].Version != 2 {
+		t.Fatalf("history of P0: %+v", versions)
+	}
+	legacy := versions[0].Project
+	if legacy.InvestAmount != 600 * MONEY_UNIT || len(legacy.Participants) != 3 || legacy.Participants[0].Confirmed {
+		t.Errorf("version 0: %+v", legacy)
+	}
+	if versions[1].Function != "confirm" || !versions[1].Project.Participants[0].Confirmed {
+		t.Errorf("version 1: %+v", versions[1])
+	}
+	l.query(&version_record, "get_project_at_version", "P0", "0")
+	if version_record.Project.ProjectName != "Legacy" {
+		t.Errorf("get_project_at_version 0: %+v", version_record)
+	}
+
+	// A project written since has no version 0
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.query(&versions, "get_project_history", "P1")
+	if len(versions) != 1 || versions[0].Version != 1 {
+		t.Errorf("history of P1: %+v", versions)
+	}
+}
+
+func TestRegisterEntityReservedCode(t *testing.T) {
+	l := new_ledger(t)
+	l.fail("register_entity", "@X", "Pseudo", ENTITY_ROLE_PARTICIPANT)
+	l.fail("register_entity", " @issue ", "Pseudo", ENTITY_ROLE_PARTICIPANT)
+	l.fail("register_entity", "X/Y", "Slash", ENTITY_ROLE_PARTICIPANT)
+	l.ok("register_entity", "X", "Plain", ENTITY_ROLE_PARTICIPANT)
+
+	// An entity written under a pseudo code before it was refused cannot pay out without cover
+	l.stub.State["entity/@X"] = []byte(`{"code":"@X","name":"Pseudo","role":"participant","active":true,"members":["admin"]}`)
+	l.fail("add_entity_member", "@X", "alice")
+	l.fail("transfer", "@X", "BK", "5000", "no cover")
+	l.fail("transfer", ACCOUNT_ISSUE, "BK", "5000", "no cover")
+	if l.amount("BK") != 0 {
+		t.Errorf("BK holds %s", l.amount("BK"))
+	}
+	delete(l.stub.State, "entity/@X")
+	l.verify()
+}
+
+func TestReservation(t *testing.T) {
+	var audit	LedgerAudit
+	var amount_record	Amount
+
+	l := new_ledger(t)
+	l.ok("set_reservation_policy", "true")
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("project", project_args("P2", "100", "100", "-", "-")...)
+	held := func(expected int64) {
+		l.query(&amount_record, "get_current_amount", "FG")
+		if amount_record.Reserved != Money(expected) * MONEY_UNIT {
+			t.Errorf("FG holds %s, expecting %d", amount_record.Reserved, expected)
+		}
+	}
+	held(700)
+	if err := l.fail("project", project_args("P3", "400", "400", "-", "-")...); !strings.Contains(err.Error(), "cannot reserve") {
+		t.Errorf("project over what FG has available: %v", err)
+	}
+
+	l.ok("cancel", "P2")
+	held(600)
+	l.ok("reopen", "P2")
+	held(700)
+
+	l.ok("confirm", "P1", "BK")
+	held(600)
+	if l.amount("FG") != 900 * MONEY_UNIT {
+		t.Errorf("after confirm FG %s", l.amount("FG"))
+	}
+	l.ok("unconfirm", "P1", "BK", "wrong team")
+	held(700)
+	if l.amount("FG") != 1000 * MONEY_UNIT || l.amount("BK") != 0 {
+		t.Errorf("after unconfirm FG %s, BK %s", l.amount("FG"), l.amount("BK"))
+	}
+
+	l.query(&audit, "audit_ledger")
+	if len(audit.Mismatches) != 0 {
+		t.Errorf("audit_ledger: %+v", audit.Mismatches)
+	}
+	l.verify()
+}
+
+func TestAuditMismatches(t *testing.T) {
+	var audit	LedgerAudit
+	var report	JournalReport
+
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("confirm", "P1", "BK")
+	l.verify()
+	l.query(&audit, "audit_ledger")
+	if len(audit.Mismatches) != 0 {
+		t.Fatalf("audit_ledger: %+v", audit.Mismatches)
+	}
+
+	// tamper rewrites the record under key, to be restored by the returned func
+	tamper := func(key string, record interface{}, change func()) func() {
+		saved := l.stub.State[key]
+		err := json.Unmarshal(saved, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change()
+		l.stub.State[key], err = json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return func() { l.stub.State[key] = saved }
+	}
+
+	var amount_record	Amount
+	restore := tamper("BK", &amount_record, func() { amount_record.Amount += 50 * MONEY_UNIT })
+	l.query(&report, "verify_journal")
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Entity != "BK" || report.Mismatches[0].Difference != 50 * MONEY_UNIT {
+		t.Errorf("verify_journal of a balance off the journal: %+v", report)
+	}
+	l.query(&audit, "audit_ledger")
+	if len(audit.Mismatches) != 1 || audit.Mismatches[0].Entity != "BK" || audit.Mismatches[0].Difference != 50 * MONEY_UNIT {
+		t.Errorf("audit_ledger of a balance off the records: %+v", audit.Mismatches)
+	}
+	restore()
+
+	restore = tamper("FG", &amount_record, func() { amount_record.Reserved = 10 * MONEY_UNIT })
+	l.query(&audit, "audit_ledger")
+	if len(audit.Mismatches) != 1 || audit.Mismatches[0].Entity != "FG" || audit.Mismatches[0].Held != 0 {
+		t.Errorf("audit_ledger of a hold no project has: %+v", audit.Mismatches)
+	}
+	restore()
+
+	var entry	JournalEntry
+	restore = tamper(fmt.Sprintf("journal/%012d", 2), &entry, func() { entry.Lines[0].Debit++ })
+	l.query(&report, "verify_journal")
+	if len(report.Unbalanced) != 1 || report.Unbalanced[0] != 2 {
+		t.Errorf("verify_journal of an unbalanced entry: %+v", report)
+	}
+	restore()
+	l.verify()
+}
+
+func TestTransferAuthorization(t *testing.T) {
+	var transfers	[]Transfer
+
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("confirm", "P1", "BK")
+
+	// Only a member of the sending entity may transfer, and only an admin makes members
+	l.as("alice")
+	l.fail("transfer", "BK", "SC", "40", "handover")
+	l.fail("add_entity_member", "BK", "alice")
+	l.as("admin")
+	l.fail("transfer", "BK", "SC", "40", "handover")
+	l.ok("add_entity_member", "BK", "alice")
+
+	l.as("alice")
+	l.ok("transfer", "BK", "SC", "40", "handover", "P1")
+	l.fail("transfer", "SC", "BK", "10", "back")
+	l.fail("transfer", "BK", "SC", "61", "more than BK has")
+	l.as("admin")
+	l.ok("remove_entity_member", "BK", "alice")
+	l.as("alice")
+	l.fail("transfer", "BK", "SC", "10", "handover")
+
+	if l.amount("BK") != 60 * MONEY_UNIT || l.amount("SC") != 40 * MONEY_UNIT {
+		t.Errorf("BK %s, SC %s", l.amount("BK"), l.amount("SC"))
+	}
+	l.query(&transfers, "get_all_transfer", "BK")
+	if len(transfers) != 1 || transfers[0].TransferredBy != "alice" || transfers[0].ProjectId != "P1" {
+		t.Errorf("transfers of BK: %+v", transfers)
+	}
+	l.verify()
+}
+
+func TestCloseFiscalYear(t *testing.T) {
+	var snapshot	BalanceSnapshot
+
+	l := new_ledger(t)
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("confirm", "P1", "BK")
+	l.fail("close_fiscal_year", "2016")
+
+	l.at(time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC))
+	l.ok("confirm", "P1", "SC")
+	l.ok("close_fiscal_year", "2016")
+	l.fail("close_fiscal_year", "2016")
+
+	l.query(&snapshot, "get_current_amount", "FG", "2016")
+	if !snapshot.Closed || snapshot.Opening != 0 || snapshot.Closing != 900 * MONEY_UNIT {
+		t.Errorf("FG over FY2016: %+v", snapshot)
+	}
+	l.query(&snapshot, "get_current_amount", "BK", "2016")
+	if !snapshot.Closed || snapshot.Closing != 100 * MONEY_UNIT {
+		t.Errorf("BK over FY2016: %+v", snapshot)
+	}
+	l.query(&snapshot, "get_current_amount", "FG", "2017")
+	if snapshot.Closed || snapshot.Opening != 900 * MONEY_UNIT || snapshot.Closing != 700 * MONEY_UNIT {
+		t.Errorf("FG over FY2017: %+v", snapshot)
+	}
+
+	// Nothing may be posted into the closed year, nor the calendar moved under it
+	l.at(time.Date(2017, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err := l.fail("confirm", "P1", "TB"); !strings.Contains(err.Error(), "FY2016 has been closed") {
+		t.Errorf("confirm into FY2016: %v", err)
+	}
+	l.at(time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC))
+	l.fail("set_fiscal_calendar", "1", FY_LABEL_END, "UTC", "0")
+	l.ok("confirm", "P1", "TB")
+	if l.amount("FG") != 400 * MONEY_UNIT {
+		t.Errorf("FG %s", l.amount("FG"))
+	}
+	l.verify()
+}
+
+func TestBudget(t *testing.T) {
+	var status	BudgetStatus
+
+	l := new_ledger(t)
+	budget := func(entity string, used int64, remaining int64) {
+		l.query(&status, "get_budget_status", entity, "2016")
+		if !status.Capped || status.Used != Money(used) * MONEY_UNIT || status.Remaining != Money(remaining) * MONEY_UNIT {
+			t.Errorf("budget of %s: %+v, expecting used %d, remaining %d", entity, status, used, remaining)
+		}
+	}
+	l.ok("issue", "P1", "1000")
+	l.ok("project", project_args("P1", "600", "100", "200", "300")...)
+	l.ok("confirm", "P1", "BK")
+	l.ok("set_budget", "BK", "2016", "250")
+	budget("BK", 100, 150)
+
+	l.ok("project", project_args("P2", "200", "200", "-", "-")...)
+	if err := l.fail("confirm", "P2", "BK"); !strings.Contains(err.Error(), "budget") {
+		t.Errorf("confirm over the budget of BK: %v", err)
+	}
+	l.ok("updateproject", project_args("P2", "150", "150", "-", "-")...)
+	l.ok("confirm", "P2", "BK")
+	budget("BK", 250, 0)
+	l.ok("unconfirm", "P1", "BK", "wrong team")
+	budget("BK", 150, 100)
+	l.ok("set_budget", "BK", "2016", "300")
+	budget("BK", 150, 150)
+
+	// Without a budget the use is worked out from the journal
+	l.ok("submit", "P1")
+	l.ok("confirm", "P1", "SC")
+	l.query(&status, "get_budget_status", "SC", "2016")
+	if status.Capped || status.Used != 200 * MONEY_UNIT {
+		t.Errorf("budget of SC: %+v", status)
+	}
+
+	// The issuer uses its budget by issue
+	l.ok("set_budget", "FG", "2016", "1500")
+	l.fail("issue", "P3", "600")
+	l.ok("issue", "P3", "500")
+	budget("FG", 1500, 0)
+
+	// A calendar which moves the postings into FY2017 leaves nothing used in FY2016
+	l.ok("set_fiscal_calendar", "10", FY_LABEL_END, "UTC", "0")
+	budget("BK", 0, 300)
+	budget("FG", 0, 1500)
+	l.verify()
+}